@@ -0,0 +1,318 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tendant/dbload/pkg/loader"
+	"github.com/tendant/dbload/pkg/value"
+)
+
+// defaultCommand runs when the first argument is a flag or there are no
+// arguments, which keeps the flags of older versions working
+const defaultCommand = "run"
+
+// command is a subcommand of dbload
+type command struct {
+	name    string
+	aliases []string
+	summary string
+	run     func(f *loadFlags) error
+	// flags registers the flags of the command
+	flags func(f *loadFlags, fs *flag.FlagSet)
+}
+
+// commands lists the subcommands in the order they are shown in the usage
+var commands = []command{
+	{
+		name:    "run",
+		aliases: []string{"load"},
+		summary: "Load the seed files into the database",
+		run:     load,
+		flags: func(f *loadFlags, fs *flag.FlagSet) {
+			f.registerSeed(fs)
+			f.registerOrder(fs)
+			f.registerInsert(fs)
+			f.registerTx(fs)
+			fs.BoolVar(&f.dryRun, "dry-run", f.dryRun, "Print SQL statements without executing them")
+		},
+	},
+	{
+		name:    "validate",
+		summary: "Check the seed files and evaluate their values without a database",
+		run:     validate,
+		flags: func(f *loadFlags, fs *flag.FlagSet) {
+			f.registerSeed(fs)
+			f.registerOrder(fs)
+		},
+	},
+	{
+		name:    "plan",
+		summary: "Print the SQL statements that run would execute",
+		run: func(f *loadFlags) error {
+			f.dryRun = true
+			return load(f)
+		},
+		flags: func(f *loadFlags, fs *flag.FlagSet) {
+			f.registerSeed(fs)
+			f.registerOrder(fs)
+			f.registerInsert(fs)
+		},
+	},
+	{
+		name:    "clean",
+		summary: "Delete the rows of the seed files from the database",
+		run:     clean,
+		flags: func(f *loadFlags, fs *flag.FlagSet) {
+			f.registerSeed(fs)
+			f.registerOrder(fs)
+			fs.BoolVar(&f.dryRun, "dry-run", f.dryRun, "Print DELETE statements without executing them")
+		},
+	},
+	{
+		name:    "functions",
+		summary: "List the functions available in value expressions",
+		run:     listFunctions,
+		flags:   func(*loadFlags, *flag.FlagSet) {},
+	},
+}
+
+// seedPaths collects the values of the repeatable -file flag
+type seedPaths []string
+
+func (p *seedPaths) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *seedPaths) Set(s string) error {
+	*p = append(*p, s)
+	return nil
+}
+
+// truncateTables holds the -truncate flag, which is given alone to truncate
+// every table of the seed files or with a comma-separated list of tables
+type truncateTables struct {
+	set    bool
+	tables []string
+}
+
+func (t *truncateTables) String() string {
+	if t == nil || !t.set {
+		return ""
+	}
+	if len(t.tables) == 0 {
+		return "true"
+	}
+	return strings.Join(t.tables, ",")
+}
+
+func (t *truncateTables) Set(s string) error {
+	switch s {
+	case "true":
+		t.set, t.tables = true, nil
+	case "false", "":
+		t.set, t.tables = false, nil
+	default:
+		t.set, t.tables = true, splitList(s)
+	}
+	return nil
+}
+
+// IsBoolFlag lets -truncate be given without a value
+func (t *truncateTables) IsBoolFlag() bool {
+	return true
+}
+
+// nowLayouts are the formats accepted by the -now flag
+var nowLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+// parseNow parses the time given with -now. Times without a zone are UTC.
+func parseNow(s string) (time.Time, error) {
+	for _, layout := range nowLayouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid -now time %q (use a time such as 2024-05-01T12:00:00Z or 2024-05-01)", s)
+}
+
+// loadFlags holds the flags of all commands. Each command only registers
+// the flags that apply to it; the others keep their defaults.
+type loadFlags struct {
+	files             seedPaths
+	driver            string
+	dryRun            bool
+	order             string
+	respectYamlOrder  bool
+	autoOrder         bool
+	useTx             bool
+	deferConstraints  bool
+	savepoints        bool
+	onConflict        string
+	conflictKey       string
+	missing           string
+	batchSize         int
+	copyMode          string
+	copyThreshold     int
+	truncate          truncateTables
+	legacyExpressions bool
+	seed              int64
+	locale            string
+	now               string
+
+	// seedSet records whether -seed was given, since 0 is a valid seed
+	seedSet bool
+	// readSchema opens DATABASE_URL, when it is set, also in a dry run
+	readSchema bool
+}
+
+// newLoadFlags returns the default flags
+func newLoadFlags() *loadFlags {
+	return &loadFlags{
+		respectYamlOrder: true,
+		useTx:            true,
+		onConflict:       "ignore",
+		conflictKey:      "id",
+		missing:          "default",
+		batchSize:        1,
+		copyMode:         "auto",
+		copyThreshold:    10000,
+		locale:           "en_US",
+	}
+}
+
+// registerSeed registers the flags that control how the seed files are read
+// and their values evaluated
+func (f *loadFlags) registerSeed(fs *flag.FlagSet) {
+	fs.Var(&f.files, "file", "Path to a YAML seed file, a directory or a glob; repeat to load several (default seed.yaml)")
+	fs.Var(&f.files, "config-path", "Alias of -file")
+	fs.StringVar(&f.onConflict, "on-conflict", f.onConflict, "Default conflict strategy for tables: ignore, upsert, fail or replace")
+	fs.StringVar(&f.conflictKey, "conflict-key", f.conflictKey, "Default comma-separated key columns for the upsert and replace strategies")
+	fs.StringVar(&f.missing, "missing", f.missing, "Default policy for columns a row leaves out: default or null")
+	fs.BoolVar(&f.legacyExpressions, "legacy-expressions", f.legacyExpressions, "Evaluate every string containing parentheses or a pipe, as older versions did")
+	fs.Int64Var(&f.seed, "seed", f.seed, "Seed for random values such as uuid() and bcrypt salts, to generate the same values on every run")
+	fs.StringVar(&f.locale, "locale", f.locale, "Locale of the data generated by the fake.* functions: "+strings.Join(value.Locales(), " or "))
+	fs.StringVar(&f.now, "now", f.now, "Time returned by now() and used by other functions, such as 2024-05-01T12:00:00Z (default: the current time)")
+}
+
+// registerOrder registers the flags that select the database and the order
+// of the tables
+func (f *loadFlags) registerOrder(fs *flag.FlagSet) {
+	fs.StringVar(&f.driver, "driver", f.driver, "Database driver: postgres, mysql, sqlite or sqlserver (default: detected from DATABASE_URL)")
+	fs.StringVar(&f.order, "order", f.order, "Comma-separated list of table names to specify insertion order")
+	fs.BoolVar(&f.respectYamlOrder, "respect-yaml-order", f.respectYamlOrder, "Process tables in the order they appear in the YAML file")
+	fs.BoolVar(&f.autoOrder, "auto-order", f.autoOrder, "Order tables by the foreign keys in the database schema")
+}
+
+// registerInsert registers the flags that control the INSERT statements
+func (f *loadFlags) registerInsert(fs *flag.FlagSet) {
+	fs.IntVar(&f.batchSize, "batch-size", f.batchSize, "Maximum number of rows per INSERT statement")
+	fs.StringVar(&f.copyMode, "copy", f.copyMode, "Load tables with COPY FROM STDIN: auto, always or never")
+	fs.IntVar(&f.copyThreshold, "copy-threshold", f.copyThreshold, "Number of rows from which -copy=auto loads a table with COPY")
+	fs.Var(&f.truncate, "truncate", "Truncate the tables of the seed files before loading, or only those listed as -truncate=a,b")
+}
+
+// registerTx registers the flags that control the transaction
+func (f *loadFlags) registerTx(fs *flag.FlagSet) {
+	fs.BoolVar(&f.useTx, "tx", f.useTx, "Load all tables in a single transaction that is rolled back on failure")
+	fs.BoolVar(&f.deferConstraints, "defer-constraints", f.deferConstraints, "Defer deferrable constraints until the transaction commits")
+	fs.BoolVar(&f.savepoints, "savepoints", f.savepoints, "Load each table in a savepoint and skip tables that fail to load")
+}
+
+// run runs the command named by the first argument with the remaining
+// arguments, or the run command when the first argument is a flag
+func run(args []string) error {
+	name := defaultCommand
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		printUsage(os.Stdout)
+		return nil
+	}
+
+	c, ok := lookupCommand(name)
+	if !ok {
+		printUsage(os.Stderr)
+		return fmt.Errorf("unknown command %q", name)
+	}
+	f, err := c.parse(args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	return c.run(f)
+}
+
+// lookupCommand finds a command by its name or one of its aliases
+func lookupCommand(name string) (command, bool) {
+	i := slices.IndexFunc(commands, func(c command) bool {
+		return c.name == name || slices.Contains(c.aliases, name)
+	})
+	if i < 0 {
+		return command{}, false
+	}
+	return commands[i], true
+}
+
+// parse parses the flags and seed file arguments of a command
+func (c command) parse(args []string) (*loadFlags, error) {
+	f := newLoadFlags()
+	fs := flag.NewFlagSet("dbload "+c.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: dbload %s [flags] [seed files]\n\n%s.\n\nFlags:\n", c.name, c.summary)
+		fs.PrintDefaults()
+	}
+	c.flags(f, fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	fs.Visit(func(fl *flag.Flag) {
+		if fl.Name == "seed" {
+			f.seedSet = true
+		}
+	})
+
+	// Seed files may also be given as arguments
+	f.files = append(f.files, fs.Args()...)
+	if len(f.files) == 0 {
+		f.files = seedPaths{"seed.yaml"}
+	}
+	return f, nil
+}
+
+// printUsage lists the commands
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: dbload <command> [flags] [seed files]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands {
+		name := strings.Join(append([]string{c.name}, c.aliases...), ", ")
+		fmt.Fprintf(w, "  %-12s %s\n", name, c.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Without a command, dbload runs %s with the flags given. Use dbload <command> -h for the flags of a command.\n", defaultCommand)
+}
+
+// listFunctions prints the signature of every function available to the
+// seed files
+func listFunctions(*loadFlags) error {
+	l, err := loader.New(loader.WithDryRun(nil), loader.WithRegistry(customFunctions()))
+	if err != nil {
+		return err
+	}
+	functions := l.Functions()
+	for _, name := range functions.Names() {
+		fn, _ := functions.Lookup(name)
+		fmt.Println(fn.Signature(name))
+	}
+	return nil
+}
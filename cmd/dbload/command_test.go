@@ -0,0 +1,122 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		args    []string
+		check   func(f *loadFlags) bool
+		wantErr string
+	}{
+		{
+			name:    "Default seed file",
+			command: "run",
+			check: func(f *loadFlags) bool {
+				return reflect.DeepEqual(f.files, seedPaths{"seed.yaml"}) && f.useTx && !f.dryRun
+			},
+		},
+		{
+			name:    "Config path is an alias of file",
+			command: "load",
+			args:    []string{"--config-path=samples/bootstrap.yaml", "-file", "more.yaml", "extra.yaml"},
+			check: func(f *loadFlags) bool {
+				return reflect.DeepEqual(f.files, seedPaths{"samples/bootstrap.yaml", "more.yaml", "extra.yaml"})
+			},
+		},
+		{
+			name:    "Seed zero is set",
+			command: "plan",
+			args:    []string{"-seed", "0", "-batch-size", "50"},
+			check:   func(f *loadFlags) bool { return f.seedSet && f.batchSize == 50 },
+		},
+		{
+			name:    "Seed unset",
+			command: "validate",
+			check:   func(f *loadFlags) bool { return !f.seedSet && f.onConflict == "ignore" },
+		},
+		{
+			name:    "Flag of another command",
+			command: "validate",
+			args:    []string{"-batch-size", "50"},
+			wantErr: "flag provided but not defined: -batch-size",
+		},
+		{
+			name:    "Truncate every table",
+			command: "run",
+			args:    []string{"-truncate"},
+			check:   func(f *loadFlags) bool { return f.truncate.set && f.truncate.tables == nil },
+		},
+		{
+			name:    "Truncate listed tables",
+			command: "plan",
+			args:    []string{"-truncate=users, orders", "seed.yaml"},
+			check: func(f *loadFlags) bool {
+				return reflect.DeepEqual(f.truncate.tables, []string{"users", "orders"}) && reflect.DeepEqual(f.files, seedPaths{"seed.yaml"})
+			},
+		},
+		{
+			name:    "Clean has a dry run",
+			command: "clean",
+			args:    []string{"-dry-run"},
+			check:   func(f *loadFlags) bool { return f.dryRun },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, ok := lookupCommand(tt.command)
+			if !ok {
+				t.Fatalf("lookupCommand(%s) not found", tt.command)
+			}
+			f, err := c.parse(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parse() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse() error = %v", err)
+			}
+			if !tt.check(f) {
+				t.Errorf("parse() = %+v", f)
+			}
+		})
+	}
+
+	if _, ok := lookupCommand("bogus"); ok {
+		t.Error("lookupCommand(bogus) found a command")
+	}
+}
+
+func TestParseNow(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Time
+		wantErr bool
+	}{
+		{input: "2024-05-01T12:30:00Z", want: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)},
+		{input: "2024-05-01T14:30:00+02:00", want: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)},
+		{input: "2024-05-01 12:30:00", want: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)},
+		{input: "2024-05-01", want: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{input: "yesterday", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseNow(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseNow(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseNow(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
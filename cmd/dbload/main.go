@@ -2,212 +2,216 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"flag"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/tendant/dbload/pkg/loader"
 	"github.com/tendant/dbload/pkg/value"
-	"gopkg.in/yaml.v3"
 )
 
-// registerCustomFunctions registers additional custom functions
-func registerCustomFunctions() {
-	// Register a custom function to generate a date in the future
-	value.RegisterFunction("future", func(args []string) (interface{}, error) {
-		if len(args) != 1 {
-			return nil, fmt.Errorf("future function requires exactly one argument (days)")
-		}
+// customFunctions returns the built-in functions with additional custom
+// functions
+func customFunctions() *value.Registry {
+	r := value.New()
 
-		// Parse the number of days
-		var days int
-		if _, err := fmt.Sscanf(args[0], "%d", &days); err != nil {
-			return nil, fmt.Errorf("future function requires a number: %w", err)
-		}
-
-		// Calculate the future date
-		futureDate := time.Now().UTC().AddDate(0, 0, days)
-		return futureDate.Format(time.RFC3339), nil
+	// Register a custom function to generate a date in the future
+	r.Register("future", value.Function{
+		Params: []value.Param{{Name: "days", Type: value.Int}},
+		Handler: func(ctx *value.Context, args []interface{}) (interface{}, error) {
+			// Calculate the future date
+			futureDate := ctx.Now().UTC().AddDate(0, 0, int(args[0].(int64)))
+			return futureDate.Format(time.RFC3339), nil
+		},
 	})
 
 	// Register a custom function to convert text to uppercase
-	value.RegisterFunction("upper", func(args []string) (interface{}, error) {
-		if len(args) != 1 {
-			return nil, fmt.Errorf("upper function requires exactly one argument")
-		}
-		return strings.ToUpper(args[0]), nil
+	r.Register("upper", value.Function{
+		Params: []value.Param{{Name: "text", Type: value.String}},
+		Handler: func(_ *value.Context, args []interface{}) (interface{}, error) {
+			return strings.ToUpper(args[0].(string)), nil
+		},
 	})
+	return r
 }
 
-// loadYAML loads data from a YAML file and returns both the data and the order of tables
-func loadYAML(path string) (map[string][]map[string]interface{}, []string, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, nil, err
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		// Errors may quote values read with env() and file()
+		fmt.Fprintln(os.Stderr, value.Mask(err.Error()))
+		os.Exit(1)
 	}
+}
 
-	// First, unmarshal into a yaml.Node to preserve order
-	var root yaml.Node
-	if err := yaml.Unmarshal(data, &root); err != nil {
-		return nil, nil, err
+// newLoader returns a Loader configured with the flags, opening the
+// database when the command needs one
+func newLoader(f *loadFlags, opts ...loader.Option) (*loader.Loader, *sql.DB, error) {
+	// Only require DATABASE_URL if not in dry run mode
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" && !f.dryRun {
+		return nil, nil, errors.New("DATABASE_URL is required (or use --dry-run)")
 	}
-
-	// Then unmarshal into our map for easier access
-	var out map[string][]map[string]interface{}
-	if err := yaml.Unmarshal(data, &out); err != nil {
+	if dsn == "" && f.autoOrder {
+		return nil, nil, errors.New("DATABASE_URL is required to read foreign keys for --auto-order")
+	}
+	driver, err := loader.DetectDriver(f.driver, dsn)
+	if err != nil {
 		return nil, nil, err
 	}
 
-	// Extract the order of tables from the yaml.Node
-	var tableOrder []string
-	if len(root.Content) > 0 && root.Content[0].Kind == yaml.MappingNode {
-		mapping := root.Content[0]
-		// In a mapping node, keys are at even indices (0, 2, 4, ...)
-		for i := 0; i < len(mapping.Content); i += 2 {
-			if mapping.Content[i].Kind == yaml.ScalarNode {
-				tableName := mapping.Content[i].Value
-				tableOrder = append(tableOrder, tableName)
-			}
+	opts = append(opts,
+		loader.WithDriver(driver),
+		loader.WithYAMLOrder(f.respectYamlOrder),
+		loader.WithConflict(f.onConflict, splitList(f.conflictKey)...),
+		loader.WithMissing(f.missing),
+		loader.WithBatchSize(f.batchSize),
+		loader.WithCopy(f.copyMode, f.copyThreshold),
+		loader.WithLocale(f.locale),
+		loader.WithRegistry(customFunctions()),
+	)
+	if f.order != "" {
+		opts = append(opts, loader.WithOrder(splitList(f.order)...))
+	}
+	if f.autoOrder {
+		opts = append(opts, loader.WithAutoOrder())
+	}
+	if !f.useTx {
+		opts = append(opts, loader.WithoutTransaction())
+	}
+	if f.deferConstraints {
+		opts = append(opts, loader.WithDeferredConstraints())
+	}
+	if f.savepoints {
+		opts = append(opts, loader.WithSavepoints())
+	}
+	if f.truncate.set {
+		opts = append(opts, loader.WithTruncate(f.truncate.tables...))
+	}
+	if f.legacyExpressions {
+		opts = append(opts, loader.WithLegacyExpressions())
+	}
+	if f.seedSet {
+		opts = append(opts, loader.WithSeed(f.seed))
+	}
+	if f.now != "" {
+		now, err := parseNow(f.now)
+		if err != nil {
+			return nil, nil, err
 		}
+		opts = append(opts, loader.WithNow(now))
 	}
 
-	// Note: YAML parsing strips quotes from values, so we need to be careful
-	// when evaluating values that might contain pipes or function calls.
-	// The Eval function will handle this by checking for specific function names
-	// and pipe characters.
-
-	return out, tableOrder, nil
-}
-
-func insertTable(db *sql.DB, table string, rows []map[string]interface{}, dryRun bool) error {
-	for _, row := range rows {
-		columns := []string{}
-		placeholders := []string{}
-		values := []interface{}{}
-		idx := 1
-		for k, v := range row {
-			if valStr, ok := v.(string); ok {
-				// Check if this is a function call or a pipe expression
-				isFunctionCall := strings.Contains(valStr, "(") && strings.Contains(valStr, ")")
-				hasPipe := strings.Contains(valStr, "|")
-
-				if isFunctionCall || hasPipe {
-					// For debugging
-					if dryRun {
-						fmt.Printf("Evaluating: %s\n", valStr)
-					}
-
-					result, err := value.Eval(valStr)
-					if err != nil {
-						return fmt.Errorf("value evaluation error in %s: %w", k, err)
-					}
-					v = result
-				}
-			}
-
-			columns = append(columns, k)
-			placeholders = append(placeholders, fmt.Sprintf("$%d", idx))
-			values = append(values, v)
-			idx++
+	// Open database connection if not in dry run mode, or if the schema is
+	// needed to order the tables
+	var db *sql.DB
+	if !f.dryRun || f.autoOrder || (f.readSchema && dsn != "") {
+		if db, err = loader.Open(driver, dsn); err != nil {
+			return nil, nil, err
 		}
+		opts = append(opts, loader.WithDB(db))
+	}
 
-		sqlStmt := fmt.Sprintf(
-			"INSERT INTO %s (%s) VALUES (%s) ON CONFLICT DO NOTHING",
-			table,
-			strings.Join(columns, ", "),
-			strings.Join(placeholders, ", "),
-		)
-
-		if dryRun {
-			// In dry run mode, print the SQL statement and values
-			fmt.Printf("SQL: %s\n", sqlStmt)
-			fmt.Printf("Values: %v\n", values)
-			fmt.Println("---")
-		} else {
-			// In normal mode, execute the SQL statement
-			_, err := db.Exec(sqlStmt, values...)
-			if err != nil {
-				return fmt.Errorf("insert into %s failed: %w", table, err)
-			}
+	l, err := loader.New(opts...)
+	if err != nil {
+		if db != nil {
+			db.Close()
 		}
+		return nil, nil, err
 	}
-	return nil
+	return l, db, nil
 }
 
-func main() {
-	// Register custom functions
-	registerCustomFunctions()
-
-	// Parse command line flags
-	path := flag.String("file", "seed.yaml", "Path to YAML seed file")
-	dryRun := flag.Bool("dry-run", false, "Print SQL statements without executing them")
-	orderStr := flag.String("order", "", "Comma-separated list of table names to specify insertion order")
-	respectYamlOrder := flag.Bool("respect-yaml-order", true, "Process tables in the order they appear in the YAML file")
-	flag.Parse()
-
-	// Only require DATABASE_URL if not in dry run mode
-	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" && !*dryRun {
-		fmt.Fprintln(os.Stderr, "DATABASE_URL is required (or use --dry-run)")
-		os.Exit(1)
+// splitList splits a comma-separated flag value
+func splitList(s string) []string {
+	if s == "" {
+		return nil
 	}
+	items := strings.Split(s, ",")
+	for i, item := range items {
+		items[i] = strings.TrimSpace(item)
+	}
+	return items
+}
 
-	// Open database connection if not in dry run mode
-	var db *sql.DB
-	var err error
-	if !*dryRun {
-		db, err = sql.Open("postgres", dsn)
-		if err != nil {
-			panic(err)
-		}
+// load loads the seed files into the database, or prints the statements it
+// would execute in dry run mode
+func load(f *loadFlags) error {
+	opts := []loader.Option{loader.WithLog(os.Stdout)}
+	if f.dryRun {
+		opts = append(opts, loader.WithDryRun(os.Stdout))
+	}
+	l, db, err := newLoader(f, opts...)
+	if err != nil {
+		return err
+	}
+	if db != nil {
 		defer db.Close()
 	}
 
-	seedData, tableOrder, err := loadYAML(*path)
+	if _, err := l.LoadFile(context.Background(), f.files...); err != nil {
+		return err
+	}
+	if f.dryRun {
+		fmt.Println("✅ Dry run completed successfully.")
+	} else {
+		fmt.Println("✅ Seed data loaded successfully.")
+	}
+	return nil
+}
+
+// validate reads the seed files and evaluates their values without
+// printing the statements
+func validate(f *loadFlags) error {
+	f.dryRun = true
+	l, db, err := newLoader(f, loader.WithDryRun(io.Discard))
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if db != nil {
+		defer db.Close()
 	}
 
-	// Process tables in specified order if provided via command line
-	if *orderStr != "" {
-		// Command line order takes precedence
-		tableOrder = strings.Split(*orderStr, ",")
-		for i, table := range tableOrder {
-			tableOrder[i] = strings.TrimSpace(table)
-		}
-		*respectYamlOrder = false // Override YAML order when explicit order is provided
-	}
-
-	// Process tables in the specified order
-	if len(tableOrder) > 0 && (*respectYamlOrder || *orderStr != "") {
-		for _, table := range tableOrder {
-			if rows, ok := seedData[table]; ok {
-				fmt.Printf("Processing table: %s (%d rows)\n", table, len(rows))
-				if err := insertTable(db, table, rows, *dryRun); err != nil {
-					panic(err)
-				}
-				// Remove the table from the map to avoid processing it again
-				delete(seedData, table)
-			} else {
-				fmt.Printf("Warning: Table '%s' in order but not found in YAML data\n", table)
-			}
-		}
+	if _, err := l.LoadFile(context.Background(), f.files...); err != nil {
+		return err
 	}
+	fmt.Println("✅ Seed files are valid.")
+	return nil
+}
 
-	// Process any remaining tables not specified in the order
-	for table, rows := range seedData {
-		fmt.Printf("Processing table: %s (%d rows)\n", table, len(rows))
-		if err := insertTable(db, table, rows, *dryRun); err != nil {
-			panic(err)
-		}
+// clean deletes the rows of the seed files from the database
+func clean(f *loadFlags) error {
+	// A dry run reads the keys and the generated ids of the rows from the
+	// database when there is one
+	f.readSchema = true
+	opts := []loader.Option{loader.WithLog(os.Stdout)}
+	if f.dryRun {
+		opts = append(opts, loader.WithDryRun(os.Stdout))
+	}
+	l, db, err := newLoader(f, opts...)
+	if err != nil {
+		return err
+	}
+	if db != nil {
+		defer db.Close()
 	}
 
-	if *dryRun {
+	result, err := l.CleanFile(context.Background(), f.files...)
+	if err != nil {
+		return err
+	}
+	if f.dryRun {
 		fmt.Println("✅ Dry run completed successfully.")
-	} else {
-		fmt.Println("✅ Seed data loaded successfully.")
+		return nil
 	}
+	var removed int64
+	for _, t := range result.Tables {
+		removed += t.Removed
+	}
+	fmt.Printf("✅ Seed data cleaned successfully, %d rows removed.\n", removed)
+	return nil
 }
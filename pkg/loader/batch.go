@@ -0,0 +1,444 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/tendant/dbload/pkg/value"
+)
+
+// insertOptions controls how the rows of a table are sent to the database
+type insertOptions struct {
+	dialect dialect
+	dryRun  bool
+	// quiet suppresses the output of a dry run, for rows generated from
+	// templates after the first
+	quiet bool
+	// out receives the statements of a dry run
+	out io.Writer
+	// batchSize is the maximum number of rows per INSERT statement
+	batchSize int
+	// copyMode selects COPY FROM STDIN: auto, always or never
+	copyMode string
+	// copyThreshold is the number of rows from which auto mode uses COPY
+	copyThreshold int
+	// legacyExpressions evaluates every string that looks like a function
+	// call or contains a pipe, as older versions did
+	legacyExpressions bool
+	// seed makes random values deterministic when set
+	seed *int64
+	// now freezes the clock of functions such as now() when set
+	now time.Time
+	// locale selects the data of the fake.* functions
+	locale string
+	// functions holds the functions the values call, value.Default()
+	// when nil
+	functions *value.Registry
+}
+
+// registry returns the registry holding the functions of the values
+func (opts insertOptions) registry() *value.Registry {
+	if opts.functions == nil {
+		return value.Default()
+	}
+	return opts.functions
+}
+
+// context returns the evaluation context of a cell
+func (opts insertOptions) context(table string, row int, column string) *value.Context {
+	ctx := &value.Context{Table: table, Row: row, Column: column, Locale: opts.locale}
+	if !opts.now.IsZero() {
+		now := opts.now
+		ctx.Clock = func() time.Time { return now }
+	}
+	if opts.seed != nil {
+		ctx.Random = cellRandom(*opts.seed, table, row, column)
+	}
+	return ctx
+}
+
+// evalRow evaluates the expressions in the i-th row of a table. Columns are
+// evaluated in the table's column order, except that a column referenced
+// with col() is evaluated before the column referencing it. Virtual columns
+// are only evaluated when referenced and are left out of the result.
+func evalRow(table string, t *seedTable, i int, opts insertOptions) (map[string]interface{}, error) {
+	row := t.Rows[i]
+	evaluated := make(map[string]interface{}, len(row))
+	// pending holds the columns being evaluated, to detect cycles
+	var pending []string
+
+	var evalColumn func(column string) (interface{}, error)
+	evalColumn = func(column string) (interface{}, error) {
+		if v, ok := evaluated[column]; ok {
+			return v, nil
+		}
+		for j, c := range pending {
+			if c == column {
+				return nil, &columnCycleError{columns: append(append([]string{}, pending[j:]...), column)}
+			}
+		}
+		cell, ok := row[column]
+		if _, isDefault := cell.(sqlDefault); !ok || isDefault {
+			return nil, fmt.Errorf("column %s is not set in this row", column)
+		}
+
+		pending = append(pending, column)
+		ctx := opts.context(table, i+1, column)
+		ctx.Value = evalColumn
+		v, err := evalCell(cell, ctx, opts)
+		pending = pending[:len(pending)-1]
+		if err != nil {
+			// Report a cycle once, instead of once for each column in it
+			var cycle *columnCycleError
+			if errors.As(err, &cycle) {
+				return nil, cycle
+			}
+			return nil, err
+		}
+		evaluated[column] = v
+		return v, nil
+	}
+
+	for _, k := range t.Columns {
+		// Columns left out of the row are inserted as they are
+		if cell, ok := row[k]; !ok || cell == (sqlDefault{}) {
+			evaluated[k] = cell
+			continue
+		}
+		if _, err := evalColumn(k); err != nil {
+			return nil, t.errorAt(table, i+1, 1, k, err)
+		}
+	}
+	for k := range evaluated {
+		if isVirtual(k) {
+			delete(evaluated, k)
+		}
+	}
+	return evaluated, nil
+}
+
+// columnCycleError reports columns of a row that reference each other
+type columnCycleError struct {
+	columns []string
+}
+
+func (e *columnCycleError) Error() string {
+	return "columns reference each other: " + strings.Join(e.columns, " -> ")
+}
+
+// evalCell evaluates a cell tagged !expr, or the ${ } expressions in a
+// string. Other strings are literal, unless legacy expressions are enabled.
+func evalCell(v interface{}, ctx *value.Context, opts insertOptions) (interface{}, error) {
+	var src string
+	var eval func(*value.Context, string) (interface{}, error)
+	r := opts.registry()
+	switch v := v.(type) {
+	case expression:
+		src, eval = string(v), r.EvalExprContext
+	case literal:
+		return string(v), nil
+	case string:
+		// Check if this is a function call or a pipe expression
+		isFunctionCall := strings.Contains(v, "(") && strings.Contains(v, ")")
+		hasPipe := strings.Contains(v, "|")
+
+		switch {
+		case strings.Contains(v, "${"):
+			src, eval = v, r.ExpandContext
+		case opts.legacyExpressions && (isFunctionCall || hasPipe):
+			src, eval = v, r.EvalContext
+		default:
+			return v, nil
+		}
+	default:
+		return v, nil
+	}
+
+	// For debugging
+	if opts.dryRun && !opts.quiet {
+		fmt.Fprintf(opts.out, "Evaluating: %s\n", src)
+	}
+	result, err := eval(ctx, src)
+	if err != nil {
+		return nil, fmt.Errorf("cannot evaluate %q: %w", src, err)
+	}
+	return result, nil
+}
+
+// rowGroup is a run of consecutive rows inserted with the same columns
+type rowGroup struct {
+	columns []string
+	rows    []map[string]interface{}
+}
+
+// groupRows splits the rows of a table into runs that can share an INSERT
+// statement. When the dialect supports DEFAULT in a VALUES list, all rows
+// use every column; otherwise the columns left to their default are omitted,
+// and rows omitting different columns go into different groups.
+func groupRows(rows []map[string]interface{}, columns []string, supportsDefault bool) []rowGroup {
+	if supportsDefault {
+		if len(rows) == 0 {
+			return nil
+		}
+		return []rowGroup{{columns: columns, rows: rows}}
+	}
+
+	var groups []rowGroup
+	for _, row := range rows {
+		var present []string
+		for _, column := range columns {
+			if _, ok := row[column].(sqlDefault); !ok {
+				present = append(present, column)
+			}
+		}
+
+		last := len(groups) - 1
+		if last >= 0 && strings.Join(groups[last].columns, "\x00") == strings.Join(present, "\x00") {
+			groups[last].rows = append(groups[last].rows, row)
+			continue
+		}
+		groups = append(groups, rowGroup{columns: present, rows: []map[string]interface{}{row}})
+	}
+	return groups
+}
+
+// splitBatches splits rows into batches of at most batchSize rows, keeping
+// each batch within the parameter limit for rows with the given number of columns
+func splitBatches(rows []map[string]interface{}, columns int, batchSize int, maxParameters int) [][]map[string]interface{} {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	if columns > 0 && maxParameters/columns < batchSize {
+		batchSize = maxParameters / columns
+	}
+
+	var batches [][]map[string]interface{}
+	for len(rows) > batchSize {
+		batches = append(batches, rows[:batchSize])
+		rows = rows[batchSize:]
+	}
+	if len(rows) > 0 {
+		batches = append(batches, rows)
+	}
+	return batches
+}
+
+// insertBatch inserts rows with a single multi-row INSERT statement and
+// records them in the store. offset is the index of the first row of the
+// batch in the table.
+func insertBatch(db execer, table string, t *seedTable, columns []string, batch []map[string]interface{}, offset int, opts insertOptions, store *rowStore) error {
+	d, dryRun := opts.dialect, opts.dryRun
+	opts.quiet = dryRun && t.generated(offset, len(batch))
+	inserted := make([]map[string]interface{}, 0, len(batch))
+	for i := range batch {
+		rowOpts := opts
+		rowOpts.quiet = dryRun && t.generated(offset+i, 1)
+		evaluated, err := evalRow(table, t, offset+i, rowOpts)
+		if err != nil {
+			return err
+		}
+		if err := coerceRow(table, t, offset+i, evaluated); err != nil {
+			return err
+		}
+		inserted = append(inserted, evaluated)
+	}
+
+	// Remove the existing rows first when replacing
+	if t.OnConflict == conflictReplace {
+		for i, row := range inserted {
+			deleteStmt, keyValues, err := deleteStatement(d, table, t.ConflictKey, row)
+			if err != nil {
+				return t.errorAt(table, offset+i+1, 1, "", fmt.Errorf("replace failed: %w", err))
+			}
+			if dryRun {
+				if !opts.quiet {
+					fmt.Fprintf(opts.out, "SQL: %s\n", deleteStmt)
+					fmt.Fprintln(opts.out, value.Mask(fmt.Sprintf("Values: %v", keyValues)))
+				}
+			} else if _, err := db.Exec(deleteStmt, keyValues...); err != nil {
+				return t.dbRowError(table, offset+i+1, 1, "delete", err)
+			}
+		}
+	}
+
+	tuples := make([]string, 0, len(inserted))
+	values := make([]interface{}, 0, len(inserted)*len(columns))
+	for _, row := range inserted {
+		placeholders := make([]string, len(columns))
+		for i, column := range columns {
+			if _, ok := row[column].(sqlDefault); ok {
+				placeholders[i] = "DEFAULT"
+				continue
+			}
+			values = append(values, row[column])
+			placeholders[i] = d.placeholder(len(values))
+		}
+		tuples = append(tuples, "("+strings.Join(placeholders, ", ")+")")
+	}
+
+	sqlStmt := d.insertStatement(table, columns, tuples, t.OnConflict, t.ConflictKey)
+
+	if dryRun {
+		// In dry run mode, print the SQL statement and values
+		if !opts.quiet {
+			fmt.Fprintf(opts.out, "SQL: %s\n", sqlStmt)
+			// Values read with env() and file() are masked
+			fmt.Fprintln(opts.out, value.Mask(fmt.Sprintf("Values: %v", values)))
+			fmt.Fprintln(opts.out, "---")
+		}
+	} else if !d.returnsRows() {
+		// Without RETURNING, only an id generated for a single row is known
+		result, err := db.Exec(sqlStmt, values...)
+		if err != nil {
+			return t.dbRowError(table, offset+1, len(inserted), "insert", err)
+		}
+		id := inserted[0][refKeyColumn]
+		if _, isDefault := id.(sqlDefault); len(inserted) == 1 && (id == nil || isDefault) {
+			if id, err := result.LastInsertId(); err == nil && id > 0 {
+				inserted[0][refKeyColumn] = id
+			} else if err := readBack(db, d, table, t, inserted, nil); err != nil {
+				// The row already existed, so read its id back
+				return t.dbRowError(table, offset+1, 1, "reading existing row", err)
+			}
+		}
+	} else {
+		// In normal mode, execute the SQL statement and collect the returned
+		// rows, which omit rows that already existed
+		result, err := db.Query(sqlStmt, values...)
+		if err != nil {
+			return t.dbRowError(table, offset+1, len(inserted), "insert", err)
+		}
+		var returned []map[string]interface{}
+		for result.Next() {
+			row, err := scanRow(result)
+			if err != nil {
+				result.Close()
+				return t.dbRowError(table, offset+1, len(inserted), "reading inserted row", err)
+			}
+			returned = append(returned, row)
+		}
+		if err := result.Err(); err != nil {
+			result.Close()
+			return t.dbRowError(table, offset+1, len(inserted), "insert", err)
+		}
+		if err := result.Close(); err != nil {
+			return t.dbRowError(table, offset+1, len(inserted), "insert", err)
+		}
+
+		// Rows are returned in insertion order, so when none was skipped
+		// they match the seed rows one by one. Otherwise they are matched
+		// by key, and the skipped rows are read back.
+		if len(returned) == len(inserted) {
+			for i, row := range returned {
+				for k, v := range row {
+					inserted[i][k] = v
+				}
+			}
+		} else if err := readBack(db, d, table, t, inserted, returned); err != nil {
+			return t.dbRowError(table, offset+1, len(inserted), "reading existing rows", err)
+		}
+	}
+
+	for _, row := range inserted {
+		store.add(table, withoutDefaults(row))
+	}
+	return nil
+}
+
+// readBack adds the values the database holds to the rows of a batch that
+// an insert did not return one by one. Each row is matched to a returned
+// row, or else looked up in the database, by its conflict key, the primary
+// key or the columns it has values for, whichever it has values for first.
+// Rows skipped because they already existed thereby get their generated ids
+// and defaults, keeping the values of the seed file.
+func readBack(db execer, d dialect, table string, t *seedTable, rows, returned []map[string]interface{}) error {
+	var primaryKey []string
+	loaded := false
+	for _, row := range rows {
+		key := t.ConflictKey
+		if !hasKey(row, key) {
+			if !loaded {
+				var err error
+				if primaryKey, err = loadPrimaryKey(db, d, table); err != nil {
+					return err
+				}
+				loaded = true
+			}
+			key = primaryKey
+		}
+		if !hasKey(row, key) {
+			key = nil
+			for _, column := range t.Columns {
+				if hasKey(row, []string{column}) {
+					key = append(key, column)
+				}
+			}
+		}
+		if len(key) == 0 {
+			continue
+		}
+
+		if match := matchRow(returned, row, key); match != nil {
+			for k, v := range match {
+				row[k] = v
+			}
+			continue
+		}
+		existing, err := lookupRow(db, d, table, key, row)
+		if err != nil {
+			return err
+		}
+		for k, v := range existing {
+			if !hasKey(row, []string{k}) {
+				row[k] = v
+			}
+		}
+	}
+	return nil
+}
+
+// hasKey reports whether a row has a value other than NULL and DEFAULT for
+// every key column
+func hasKey(row map[string]interface{}, key []string) bool {
+	if len(key) == 0 {
+		return false
+	}
+	for _, column := range key {
+		v, ok := row[column]
+		if _, isDefault := v.(sqlDefault); !ok || v == nil || isDefault {
+			return false
+		}
+	}
+	return true
+}
+
+// matchRow returns the row of rows with the same key values as row, or nil
+func matchRow(rows []map[string]interface{}, row map[string]interface{}, key []string) map[string]interface{} {
+	for _, candidate := range rows {
+		matches := true
+		for _, column := range key {
+			if fmt.Sprint(candidate[column]) != fmt.Sprint(row[column]) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return candidate
+		}
+	}
+	return nil
+}
+
+// withoutDefaults removes the columns left to their database default that
+// were not returned by the database
+func withoutDefaults(row map[string]interface{}) map[string]interface{} {
+	for k, v := range row {
+		if _, ok := v.(sqlDefault); ok {
+			delete(row, k)
+		}
+	}
+	return row
+}
@@ -0,0 +1,200 @@
+package loader
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tendant/dbload/pkg/value"
+)
+
+func TestSplitBatches(t *testing.T) {
+	rows := func(n int) []map[string]interface{} {
+		out := make([]map[string]interface{}, n)
+		for i := range out {
+			out[i] = map[string]interface{}{"id": i}
+		}
+		return out
+	}
+
+	tests := []struct {
+		name      string
+		rows      []map[string]interface{}
+		columns   int
+		batchSize int
+		want      []int
+	}{
+		{name: "One row per batch", rows: rows(3), columns: 1, batchSize: 1, want: []int{1, 1, 1}},
+		{name: "Batch size limits rows", rows: rows(3), columns: 1, batchSize: 2, want: []int{2, 1}},
+		{name: "Exact multiple of batch size", rows: rows(4), columns: 1, batchSize: 2, want: []int{2, 2}},
+		{name: "Zero batch size is one row per batch", rows: rows(2), columns: 1, batchSize: 0, want: []int{1, 1}},
+		{name: "Parameter limit shrinks batches", rows: rows(100), columns: 1000, batchSize: 100, want: []int{65, 35}},
+		{name: "No rows", rows: nil, columns: 1, batchSize: 10, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batches := splitBatches(tt.rows, tt.columns, tt.batchSize, postgresDialect{}.maxParameters())
+			if len(batches) != len(tt.want) {
+				t.Fatalf("splitBatches() returned %d batches, want %d", len(batches), len(tt.want))
+			}
+			for i, batch := range batches {
+				if len(batch) != tt.want[i] {
+					t.Errorf("batch %d has %d rows, want %d", i, len(batch), tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGroupRows(t *testing.T) {
+	columns := []string{"id", "name", "email"}
+	rows := []map[string]interface{}{
+		{"id": 1, "name": "John", "email": "john@example.com"},
+		{"id": 2, "name": "Jane", "email": sqlDefault{}},
+		{"id": 3, "name": "Jim", "email": sqlDefault{}},
+		{"id": 4, "name": "Joe", "email": "joe@example.com"},
+	}
+
+	groups := groupRows(rows, columns, true)
+	if len(groups) != 1 || len(groups[0].rows) != 4 || len(groups[0].columns) != 3 {
+		t.Errorf("Expected a single group with every column when DEFAULT is supported, got %v", groups)
+	}
+
+	groups = groupRows(rows, columns, false)
+	want := []struct {
+		columns int
+		rows    int
+	}{{3, 1}, {2, 2}, {3, 1}}
+	if len(groups) != len(want) {
+		t.Fatalf("groupRows() returned %d groups, want %d", len(groups), len(want))
+	}
+	for i, group := range groups {
+		if len(group.columns) != want[i].columns || len(group.rows) != want[i].rows {
+			t.Errorf("group %d has %d columns and %d rows, want %d and %d",
+				i, len(group.columns), len(group.rows), want[i].columns, want[i].rows)
+		}
+	}
+}
+
+func TestEvalCell(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  interface{}
+		legacy bool
+		want   interface{}
+	}{
+		{name: "Plain string is literal", value: "Call me (maybe)", want: "Call me (maybe)"},
+		{name: "Pipe is literal", value: "A|B testing", want: "A|B testing"},
+		{name: "Embedded expression", value: "${ upper(admin) }", want: "ADMIN"},
+		{name: "Tagged expression", value: expression(`"a" | upper()`), want: "A"},
+		{name: "Tagged literal", value: literal("${ upper(admin) }"), want: "${ upper(admin) }"},
+		{name: "Legacy call", value: "upper(admin)", legacy: true, want: "ADMIN"},
+		{name: "Legacy keeps tagged literal", value: literal("upper(admin)"), legacy: true, want: "upper(admin)"},
+		{name: "Number", value: 42, want: 42},
+	}
+
+	functions := value.New()
+	functions.RegisterFunction("upper", func(args []string) (interface{}, error) {
+		return strings.ToUpper(args[0]), nil
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := evalCell(tt.value, nil, insertOptions{functions: functions, legacyExpressions: tt.legacy})
+			if err != nil {
+				t.Fatalf("evalCell() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("evalCell() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalRowColumnReferences(t *testing.T) {
+	functions := value.New()
+	functions.RegisterFunction("lower", func(args []string) (interface{}, error) {
+		return strings.ToLower(args[0]), nil
+	})
+
+	tests := []struct {
+		name    string
+		row     map[string]interface{}
+		columns []string
+		want    map[string]interface{}
+		wantErr string
+	}{
+		{
+			name:    "Column defined later",
+			row:     map[string]interface{}{"email": "${ col(name) | lower() }@example.com", "name": "John"},
+			columns: []string{"email", "name"},
+			want:    map[string]interface{}{"email": "john@example.com", "name": "John"},
+		},
+		{
+			name:    "Chained references",
+			row:     map[string]interface{}{"c": "${ col(b) }!", "b": "${ col(a) }?", "a": 1},
+			columns: []string{"c", "b", "a"},
+			want:    map[string]interface{}{"c": "1?!", "b": "1?", "a": 1},
+		},
+		{
+			name:    "Virtual column is not inserted",
+			row:     map[string]interface{}{"_name": "Jane Doe", "slug": expression("col(_name) | lower()")},
+			columns: []string{"slug"},
+			want:    map[string]interface{}{"slug": "jane doe"},
+		},
+		{
+			name:    "Reference keeps the type",
+			row:     map[string]interface{}{"a": 42, "b": expression("col(a)")},
+			columns: []string{"a", "b"},
+			want:    map[string]interface{}{"a": 42, "b": 42},
+		},
+		{
+			name:    "Cycle",
+			row:     map[string]interface{}{"a": "${ col(b) }", "b": "${ col(c) }", "c": "${ col(a) }"},
+			columns: []string{"a", "b", "c"},
+			wantErr: "seed.yaml:2:5 users[1].a: columns reference each other: a -> b -> c -> a",
+		},
+		{
+			name:    "Self reference",
+			row:     map[string]interface{}{"a": "${ col(a) }"},
+			columns: []string{"a"},
+			wantErr: "columns reference each other: a -> a",
+		},
+		{
+			name:    "Unknown column",
+			row:     map[string]interface{}{"a": "${ col(_b) }"},
+			columns: []string{"a"},
+			wantErr: "column _b is not set in this row",
+		},
+		{
+			name:    "Column inserted as DEFAULT",
+			row:     map[string]interface{}{"a": "${ col(b) }", "b": sqlDefault{}},
+			columns: []string{"a", "b"},
+			wantErr: "column b is not set in this row",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := &seedTable{
+				Rows:      []map[string]interface{}{tt.row},
+				Columns:   tt.columns,
+				Positions: []rowPosition{{position: position{file: "seed.yaml", line: 2, column: 5}}},
+			}
+			got, err := evalRow("users", table, 0, insertOptions{functions: functions})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("evalRow() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("evalRow() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("evalRow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
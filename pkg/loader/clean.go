@@ -0,0 +1,227 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tendant/dbload/pkg/value"
+)
+
+// deletion is the DELETE statement removing a row of the seed files
+type deletion struct {
+	row    int
+	stmt   string
+	values []interface{}
+}
+
+// CleanFile deletes the rows of the seed files matching each path from the
+// database. The tables are cleaned in the reverse of their dependency order,
+// read from the foreign keys when the dialect supports it, so that rows are
+// deleted before the rows they are referenced by. Each row is matched by the
+// natural_key of its table, or else by its primary key. In a dry run, the
+// DELETE statements are printed instead.
+func (l *Loader) CleanFile(ctx context.Context, paths ...string) (*Result, error) {
+	s := newSeedLoader(seedFS{})
+	if err := s.loadPaths(paths...); err != nil {
+		return nil, err
+	}
+	return masked(l.clean(ctx, s))
+}
+
+// clean deletes the rows of the tables read by s
+func (l *Loader) clean(ctx context.Context, s *seedLoader) (*Result, error) {
+	// Without a database, the tables are cleaned in the reverse of the
+	// load order
+	autoOrder := l.autoOrder || (l.db != nil && l.dialect.foreignKeyQuery() != "")
+	order, err := l.prepare(ctx, s, autoOrder)
+	if err != nil {
+		return nil, err
+	}
+	store := newRowStore()
+	d, opts := l.dialect, l.insertOptions(l.newRegistry(store))
+	opts.quiet = true
+
+	conn, tx, _, err := l.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if tx != nil {
+		defer tx.Rollback()
+	}
+	// A dry run with a database reads the schema and the rows from it, and
+	// only prints the DELETE statements
+	if l.dryRun && l.db != nil {
+		conn = contextConn{ctx: ctx, db: l.db}
+	}
+
+	// Evaluate the rows in load order, so that ref() finds the rows of the
+	// tables loaded before
+	deletions := map[string][]deletion{}
+	for _, table := range order {
+		t := s.tables[table]
+		// A dry run without a database assumes the primary key is id
+		primaryKey := []string{refKeyColumn}
+		if conn != nil {
+			types, err := loadColumnTypes(conn, d, table)
+			if err != nil {
+				return nil, t.errorAt(table, 0, 0, "", err)
+			}
+			t.Types = types
+			if primaryKey, err = loadPrimaryKey(conn, d, table); err != nil {
+				return nil, t.errorAt(table, 0, 0, "", err)
+			}
+		}
+		for i := range t.Rows {
+			row, err := evalRow(table, t, i, opts)
+			if err != nil {
+				return nil, err
+			}
+			if err := coerceRow(table, t, i, row); err != nil {
+				return nil, err
+			}
+			key, err := cleanKey(t, primaryKey, row)
+			if err != nil {
+				return nil, t.errorAt(table, i+1, 1, "", fmt.Errorf("clean failed: %w", err))
+			}
+			stmt, values, err := deleteStatement(d, table, key, row)
+			if err != nil {
+				return nil, t.errorAt(table, i+1, 1, "", fmt.Errorf("clean failed: %w", err))
+			}
+
+			// Read the row from the database, so that ref() finds the
+			// values the database filled in when it was loaded, such as
+			// generated ids
+			if conn != nil {
+				existing, err := lookupRow(conn, d, table, key, row)
+				if err != nil {
+					return nil, t.dbRowError(table, i+1, 1, "lookup", err)
+				}
+				if existing == nil {
+					// A row that is no longer in the database has no
+					// values for the columns the database filled in
+					existing = map[string]interface{}{}
+					for column := range t.Types {
+						existing[column] = nil
+					}
+				}
+				for column, v := range existing {
+					if _, ok := row[column]; !ok {
+						row[column] = v
+					}
+				}
+			}
+			store.add(table, row)
+			deletions[table] = append(deletions[table], deletion{row: i + 1, stmt: stmt, values: values})
+		}
+	}
+
+	result := &Result{}
+	for i := len(order) - 1; i >= 0; i-- {
+		table := order[i]
+		start := time.Now()
+		fmt.Fprintf(l.log, "Cleaning table: %s (%d rows)\n", table, len(deletions[table]))
+		var removed int64
+		for _, del := range deletions[table] {
+			if l.dryRun {
+				fmt.Fprintf(l.out, "SQL: %s\n", del.stmt)
+				fmt.Fprintln(l.out, value.Mask(fmt.Sprintf("Values: %v", del.values)))
+				fmt.Fprintln(l.out, "---")
+				continue
+			}
+			res, err := conn.Exec(del.stmt, del.values...)
+			if err == nil {
+				var n int64
+				n, err = res.RowsAffected()
+				removed += n
+			}
+			if err != nil {
+				if tx != nil {
+					fmt.Fprintln(l.log, "Transaction rolled back, no seed data was deleted.")
+				}
+				return nil, s.tables[table].dbRowError(table, del.row, 1, "delete", err)
+			}
+		}
+		if !l.dryRun {
+			fmt.Fprintf(l.log, "Removed %d rows from %s\n", removed, table)
+		}
+		result.Tables = append(result.Tables, TableResult{Name: table, Rows: store.tableRows(table), Removed: removed, Duration: time.Since(start)})
+	}
+
+	if tx != nil {
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("commit failed: %w", dbError(err))
+		}
+	}
+	return result, nil
+}
+
+// cleanKey returns the columns a row of the table is deleted by: the
+// natural_key of the table, or else the primary key
+func cleanKey(t *seedTable, primaryKey []string, row map[string]interface{}) ([]string, error) {
+	if len(t.NaturalKey) > 0 {
+		return t.NaturalKey, checkKey("natural_key", t.NaturalKey, row)
+	}
+	if len(primaryKey) == 0 {
+		return nil, errors.New("table has no primary key; set natural_key to match its rows")
+	}
+	if err := checkKey("primary key", primaryKey, row); err != nil {
+		return nil, fmt.Errorf("%w; set natural_key to match the row by other columns", err)
+	}
+	return primaryKey, nil
+}
+
+// checkKey checks that a row has a value for every key column. A NULL value
+// is accepted and matches no row.
+func checkKey(name string, key []string, row map[string]interface{}) error {
+	for _, column := range key {
+		v, ok := row[column]
+		if _, isDefault := v.(sqlDefault); !ok || isDefault {
+			return fmt.Errorf("row has no value for %s column %s", name, column)
+		}
+	}
+	return nil
+}
+
+// lookupRow returns the row of the database matching the key columns of a
+// row, or nil when there is none
+func lookupRow(db execer, d dialect, table string, key []string, row map[string]interface{}) (map[string]interface{}, error) {
+	where, values, err := keyCondition(d, key, row)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE %s", quoteName(d, table), where), values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	return scanRow(rows)
+}
+
+// loadPrimaryKey reads the columns of the primary key of a table from the
+// catalog
+func loadPrimaryKey(db execer, d dialect, table string) ([]string, error) {
+	query, args := d.primaryKeyQuery(table)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("reading primary key failed: %w", dbError(err))
+	}
+	defer rows.Close()
+
+	var key []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, fmt.Errorf("reading primary key failed: %w", dbError(err))
+		}
+		key = append(key, column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading primary key failed: %w", dbError(err))
+	}
+	return key, nil
+}
@@ -0,0 +1,122 @@
+package loader
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// cleanSeed lists orders before the users they reference, so that cleaning
+// in the reverse of the YAML order would violate the foreign key
+const cleanSeed = `
+orders:
+  - id: 1
+    user_id: "${ ref(users, 1, id) }"
+users:
+  natural_key: [email]
+  rows:
+    - email: "john@example.com"
+`
+
+func TestCleanFileSQLite(t *testing.T) {
+	db := openTestDB(t, loaderSchema)
+	path := filepath.Join(writeSeedFiles(t, map[string]string{"seed.yaml": cleanSeed}), "seed.yaml")
+
+	l, err := New(WithDB(db), WithDriver("sqlite"), WithAutoOrder())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, err := l.LoadFile(t.Context(), path); err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	// A row the seed file did not insert is kept
+	if _, err := db.Exec("INSERT INTO users (email) VALUES ('jane@example.com')"); err != nil {
+		t.Fatal(err)
+	}
+
+	var log bytes.Buffer
+	l, err = New(WithDB(db), WithDriver("sqlite"), WithLog(&log))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	result, err := l.CleanFile(t.Context(), path)
+	if err != nil {
+		t.Fatalf("CleanFile() error = %v", err)
+	}
+	if len(result.Tables) != 2 || result.Tables[0].Name != "orders" || result.Tables[1].Name != "users" {
+		t.Fatalf("Tables = %+v, want orders before users", result.Tables)
+	}
+	for _, table := range result.Tables {
+		if table.Removed != 1 {
+			t.Errorf("%s Removed = %d, want 1", table.Name, table.Removed)
+		}
+	}
+	if !strings.Contains(log.String(), "Removed 1 rows from users") {
+		t.Errorf("log = %q, want the removed rows", log.String())
+	}
+	var emails []string
+	rows, err := db.Query("SELECT email FROM users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			t.Fatal(err)
+		}
+		emails = append(emails, email)
+	}
+	if len(emails) != 1 || emails[0] != "jane@example.com" {
+		t.Errorf("users after clean = %v, want jane@example.com only", emails)
+	}
+
+	// Cleaning again removes nothing
+	result, err = l.CleanFile(t.Context(), path)
+	if err != nil {
+		t.Fatalf("CleanFile() again error = %v", err)
+	}
+	for _, table := range result.Tables {
+		if table.Removed != 0 {
+			t.Errorf("%s Removed = %d, want 0", table.Name, table.Removed)
+		}
+	}
+}
+
+func TestCleanKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		table      *seedTable
+		primaryKey []string
+		row        map[string]interface{}
+		want       string
+		wantErr    string
+	}{
+		{name: "Primary key", table: &seedTable{}, primaryKey: []string{"id"}, row: map[string]interface{}{"id": 1}, want: "id"},
+		{name: "Natural key", table: &seedTable{NaturalKey: []string{"org", "email"}}, primaryKey: []string{"id"}, row: map[string]interface{}{"org": 1, "email": "a"}, want: "org,email"},
+		{name: "Generated primary key", table: &seedTable{}, primaryKey: []string{"id"}, row: map[string]interface{}{"email": "a"}, wantErr: "row has no value for primary key column id; set natural_key"},
+		{name: "Default value", table: &seedTable{}, primaryKey: []string{"id"}, row: map[string]interface{}{"id": sqlDefault{}}, wantErr: "primary key column id"},
+		{name: "Missing natural key", table: &seedTable{NaturalKey: []string{"email"}}, row: map[string]interface{}{"name": "a"}, wantErr: "row has no value for natural_key column email"},
+		{name: "Null natural key", table: &seedTable{NaturalKey: []string{"email"}}, row: map[string]interface{}{"email": nil}, want: "email"},
+		{name: "No primary key", table: &seedTable{}, row: map[string]interface{}{"id": 1}, wantErr: "table has no primary key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cleanKey(tt.table, tt.primaryKey, tt.row)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("cleanKey() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("cleanKey() error = %v", err)
+			}
+			if strings.Join(got, ",") != tt.want {
+				t.Errorf("cleanKey() = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
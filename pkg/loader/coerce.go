@@ -0,0 +1,487 @@
+package loader
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Kinds of columns that values are converted for
+const (
+	kindOther = iota
+	kindText
+	kindInteger
+	kindNumeric
+	kindBoolean
+	kindTimestamp
+	kindDate
+	kindJSON
+	kindBytes
+	kindUUID
+	kindEnum
+)
+
+// columnType is the type of a column as read from the database catalog
+type columnType struct {
+	name   string
+	kind   int
+	labels []string
+	// elem is the element type of an array column, nil otherwise
+	elem *columnType
+}
+
+// typeKinds maps the type names of the supported databases to their kind
+var typeKinds = map[string]int{
+	"text": kindText, "varchar": kindText, "character varying": kindText, "char": kindText,
+	"character": kindText, "bpchar": kindText, "citext": kindText, "name": kindText,
+	"nvarchar": kindText, "nchar": kindText, "ntext": kindText, "tinytext": kindText,
+	"mediumtext": kindText, "longtext": kindText, "clob": kindText,
+
+	"smallint": kindInteger, "integer": kindInteger, "int": kindInteger, "bigint": kindInteger,
+	"int2": kindInteger, "int4": kindInteger, "int8": kindInteger, "tinyint": kindInteger,
+	"mediumint": kindInteger, "serial": kindInteger, "bigserial": kindInteger,
+
+	"numeric": kindNumeric, "decimal": kindNumeric, "real": kindNumeric, "float": kindNumeric,
+	"float4": kindNumeric, "float8": kindNumeric, "double": kindNumeric,
+	"double precision": kindNumeric, "money": kindNumeric, "smallmoney": kindNumeric,
+
+	"boolean": kindBoolean, "bool": kindBoolean, "bit": kindBoolean,
+
+	"timestamp": kindTimestamp, "timestamptz": kindTimestamp, "datetime": kindTimestamp,
+	"datetime2": kindTimestamp, "datetimeoffset": kindTimestamp, "smalldatetime": kindTimestamp,
+	"timestamp with time zone": kindTimestamp, "timestamp without time zone": kindTimestamp,
+	"date": kindDate,
+
+	"json": kindJSON, "jsonb": kindJSON,
+
+	"bytea": kindBytes, "blob": kindBytes, "tinyblob": kindBytes, "mediumblob": kindBytes,
+	"longblob": kindBytes, "binary": kindBytes, "varbinary": kindBytes,
+
+	"uuid": kindUUID, "uniqueidentifier": kindUUID,
+}
+
+// parseColumnType classifies a type name from the catalog. Arrays are
+// written as their element type followed by [], and labels lists the
+// values of an enum, one per line.
+func parseColumnType(name string, labels string) columnType {
+	typeName := strings.ToLower(strings.TrimSpace(name))
+	if elem, ok := strings.CutSuffix(typeName, "[]"); ok {
+		elemType := parseColumnType(elem, labels)
+		return columnType{name: name, kind: kindOther, elem: &elemType}
+	}
+	if labels != "" {
+		return columnType{name: name, kind: kindEnum, labels: strings.Split(labels, "\n")}
+	}
+
+	// Strip length and precision, and read the labels of MySQL enums
+	base, args, _ := strings.Cut(typeName, "(")
+	base = strings.TrimSpace(base)
+	if base == "enum" {
+		return columnType{name: name, kind: kindEnum, labels: parseEnumLabels(strings.TrimSuffix(args, ")"))}
+	}
+	// MySQL has no boolean type and stores booleans as tinyint(1)
+	if typeName == "tinyint(1)" {
+		return columnType{name: name, kind: kindBoolean}
+	}
+	base = strings.TrimSuffix(base, " unsigned")
+	return columnType{name: name, kind: typeKinds[base]}
+}
+
+// parseEnumLabels reads the quoted labels of a MySQL enum type, in which
+// quotes are escaped by doubling them
+func parseEnumLabels(s string) []string {
+	var labels []string
+	for _, part := range strings.Split(s, "','") {
+		part = strings.TrimPrefix(part, "'")
+		part = strings.TrimSuffix(part, "'")
+		labels = append(labels, strings.ReplaceAll(part, "''", "'"))
+	}
+	return labels
+}
+
+// loadColumnTypes reads the types of the columns of a table from the
+// catalog. It returns nil when the dialect cannot read them.
+func loadColumnTypes(db execer, d dialect, table string) (map[string]columnType, error) {
+	query, args := d.columnTypeQuery(table)
+	if query == "" {
+		return nil, nil
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("reading column types failed: %w", dbError(err))
+	}
+	defer rows.Close()
+
+	types := map[string]columnType{}
+	for rows.Next() {
+		var column, typeName, labels string
+		if err := rows.Scan(&column, &typeName, &labels); err != nil {
+			return nil, fmt.Errorf("reading column types failed: %w", dbError(err))
+		}
+		types[column] = parseColumnType(typeName, labels)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading column types failed: %w", dbError(err))
+	}
+	return types, nil
+}
+
+// coerceRow converts the values of the evaluated i-th row of a table to the
+// types of their columns
+func coerceRow(table string, t *seedTable, i int, row map[string]interface{}) error {
+	if len(t.Types) == 0 {
+		return nil
+	}
+	for _, column := range t.Columns {
+		ct, ok := t.Types[column]
+		if !ok {
+			// The column name may be quoted in the seed file
+			ct, ok = t.Types[canonicalName(column)]
+		}
+		if !ok {
+			continue
+		}
+		converted, err := coerceValue(row[column], ct)
+		if err != nil {
+			return t.errorAt(table, i+1, 1, column, fmt.Errorf("invalid value for %s column: %w", ct.name, err))
+		}
+		row[column] = converted
+	}
+	return nil
+}
+
+// coerceValue converts a value decoded from YAML, or returned by a value
+// function, to a value the driver accepts for a column of type ct
+func coerceValue(v interface{}, ct columnType) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if _, ok := v.(sqlDefault); ok {
+		return v, nil
+	}
+	if ct.elem != nil {
+		return coerceArray(v, *ct.elem)
+	}
+
+	switch ct.kind {
+	case kindText:
+		s, err := coerceText(v)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case kindInteger:
+		return coerceInteger(v)
+	case kindNumeric:
+		return coerceNumeric(v)
+	case kindBoolean:
+		return coerceBoolean(v)
+	case kindTimestamp:
+		return coerceTime(v, false)
+	case kindDate:
+		return coerceTime(v, true)
+	case kindJSON:
+		return coerceJSON(v)
+	case kindBytes:
+		return coerceBytes(v)
+	case kindUUID:
+		s, err := coerceText(v)
+		if err != nil {
+			return nil, err
+		}
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("expected a UUID, got %q", s)
+		}
+		return id.String(), nil
+	case kindEnum:
+		s, err := coerceText(v)
+		if err != nil {
+			return nil, err
+		}
+		for _, label := range ct.labels {
+			if s == label {
+				return s, nil
+			}
+		}
+		return nil, fmt.Errorf("%q is not one of %s", s, strings.Join(ct.labels, ", "))
+	default:
+		if isCollection(v) {
+			return nil, fmt.Errorf("expected a single value, got %s", describe(v))
+		}
+		return v, nil
+	}
+}
+
+// coerceText converts scalars to their text form
+func coerceText(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case []byte:
+		return string(v), nil
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("expected text, got %s", describe(v))
+	}
+}
+
+func coerceInteger(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint64:
+		if v > math.MaxInt64 {
+			return nil, fmt.Errorf("%d is out of range for an integer", v)
+		}
+		return int64(v), nil
+	case float64:
+		if v != math.Trunc(v) || math.Abs(v) > math.MaxInt64 {
+			return nil, fmt.Errorf("expected an integer, got %v", v)
+		}
+		return int64(v), nil
+	case bool:
+		if v {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case string:
+		i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected an integer, got %q", v)
+		}
+		return i, nil
+	default:
+		return nil, fmt.Errorf("expected an integer, got %s", describe(v))
+	}
+}
+
+// coerceNumeric checks that a value is a number. Strings are passed on as
+// they are, so that decimals keep their precision.
+func coerceNumeric(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case int, int64, uint64, float64:
+		return v, nil
+	case string:
+		s := strings.TrimSpace(v)
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return nil, fmt.Errorf("expected a number, got %q", v)
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("expected a number, got %s", describe(v))
+	}
+}
+
+func coerceBoolean(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case bool:
+		return v, nil
+	case int:
+		if v == 0 || v == 1 {
+			return v == 1, nil
+		}
+	case int64:
+		// Expressions such as ${ 1 } evaluate to int64
+		if v == 0 || v == 1 {
+			return v == 1, nil
+		}
+	case float64:
+		if v == 0 || v == 1 {
+			return v == 1, nil
+		}
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "true", "t", "yes", "y", "on", "1":
+			return true, nil
+		case "false", "f", "no", "n", "off", "0":
+			return false, nil
+		}
+	}
+	return nil, fmt.Errorf("expected a boolean, got %s", describe(v))
+}
+
+// timeLayouts are the accepted forms of timestamps and dates written as text
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// coerceTime parses timestamps and dates. Dates drop the time of day.
+func coerceTime(v interface{}, dateOnly bool) (interface{}, error) {
+	expected := "a timestamp"
+	if dateOnly {
+		expected = "a date"
+	}
+
+	var t time.Time
+	switch v := v.(type) {
+	case time.Time:
+		t = v
+	case string:
+		s := strings.TrimSpace(v)
+		parsed := false
+		for _, layout := range timeLayouts {
+			if p, err := time.Parse(layout, s); err == nil {
+				t, parsed = p, true
+				break
+			}
+		}
+		if !parsed {
+			return nil, fmt.Errorf("expected %s, got %q", expected, v)
+		}
+	default:
+		return nil, fmt.Errorf("expected %s, got %s", expected, describe(v))
+	}
+
+	if dateOnly {
+		return t.Format("2006-01-02"), nil
+	}
+	return t, nil
+}
+
+// coerceJSON encodes mappings, lists and scalars as JSON. Strings must
+// already hold a JSON document and are passed on unchanged.
+func coerceJSON(v interface{}) (interface{}, error) {
+	if s, ok := v.(string); ok {
+		if !json.Valid([]byte(s)) {
+			return nil, fmt.Errorf("expected a JSON document, got %q", s)
+		}
+		return s, nil
+	}
+	data, err := json.Marshal(jsonValue(v))
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode %s as JSON: %w", describe(v), err)
+	}
+	return string(data), nil
+}
+
+// jsonValue converts YAML mappings with non-string keys, which JSON cannot
+// represent, into mappings with string keys
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[k] = jsonValue(item)
+		}
+		return out
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[fmt.Sprint(k)] = jsonValue(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = jsonValue(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// coerceBytes decodes binary values written as hex, with a \x or 0x prefix,
+// or as base64
+func coerceBytes(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		s := strings.TrimSpace(v)
+		if hexDigits, ok := cutPrefixFold(s, `\x`, "0x"); ok {
+			data, err := hex.DecodeString(hexDigits)
+			if err != nil {
+				return nil, fmt.Errorf("invalid hex in %q: %w", v, err)
+			}
+			return data, nil
+		}
+		data, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("expected base64 or \\x-prefixed hex, got %q", v)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("expected binary data, got %s", describe(v))
+	}
+}
+
+// cutPrefixFold removes the first of the prefixes s starts with, ignoring case
+func cutPrefixFold(s string, prefixes ...string) (string, bool) {
+	for _, prefix := range prefixes {
+		if len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix) {
+			return s[len(prefix):], true
+		}
+	}
+	return s, false
+}
+
+// coerceArray converts the items of a list to the element type. Strings are
+// passed on unchanged as array literals such as {1,2,3}.
+func coerceArray(v interface{}, elem columnType) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		if !strings.HasPrefix(strings.TrimSpace(v), "{") {
+			return nil, fmt.Errorf("expected a list or an array literal, got %q", v)
+		}
+		return v, nil
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			converted, err := coerceValue(item, elem)
+			if err != nil {
+				return nil, fmt.Errorf("item %d: %w", i+1, err)
+			}
+			items[i] = converted
+		}
+		return pq.Array(items), nil
+	default:
+		return nil, fmt.Errorf("expected a list, got %s", describe(v))
+	}
+}
+
+// isCollection reports whether v is a YAML mapping or list
+func isCollection(v interface{}) bool {
+	switch v.(type) {
+	case map[string]interface{}, map[interface{}]interface{}, []interface{}:
+		return true
+	}
+	return false
+}
+
+// describe names the kind of a value for errors
+func describe(v interface{}) string {
+	switch v := v.(type) {
+	case map[string]interface{}, map[interface{}]interface{}:
+		return "a mapping"
+	case []interface{}:
+		return "a list"
+	case string:
+		return strconv.Quote(v)
+	case bool:
+		return fmt.Sprintf("boolean %v", v)
+	case time.Time:
+		return "timestamp " + v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,140 @@
+package loader
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestParseColumnType(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels string
+		kind   int
+		elem   int
+		enum   []string
+	}{
+		{name: "int4", kind: kindInteger},
+		{name: "INTEGER", kind: kindInteger},
+		{name: "int(11) unsigned", kind: kindInteger},
+		{name: "VARCHAR(255)", kind: kindText},
+		{name: "numeric", kind: kindNumeric},
+		{name: "double precision", kind: kindNumeric},
+		{name: "timestamptz", kind: kindTimestamp},
+		{name: "datetime2", kind: kindTimestamp},
+		{name: "date", kind: kindDate},
+		{name: "bool", kind: kindBoolean},
+		{name: "tinyint(1)", kind: kindBoolean},
+		{name: "jsonb", kind: kindJSON},
+		{name: "bytea", kind: kindBytes},
+		{name: "uniqueidentifier", kind: kindUUID},
+		{name: "inet", kind: kindOther},
+		{name: "mood", labels: "happy\nsad", kind: kindEnum, enum: []string{"happy", "sad"}},
+		{name: "enum('a','it''s')", kind: kindEnum, enum: []string{"a", "it's"}},
+		{name: "int4[]", kind: kindOther, elem: kindInteger},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ct := parseColumnType(tt.name, tt.labels)
+			if ct.kind != tt.kind {
+				t.Errorf("parseColumnType() kind = %d, want %d", ct.kind, tt.kind)
+			}
+			if tt.elem != kindOther && (ct.elem == nil || ct.elem.kind != tt.elem) {
+				t.Errorf("parseColumnType() elem = %v, want kind %d", ct.elem, tt.elem)
+			}
+			if !reflect.DeepEqual(ct.labels, tt.enum) {
+				t.Errorf("parseColumnType() labels = %q, want %q", ct.labels, tt.enum)
+			}
+		})
+	}
+}
+
+func TestCoerceValue(t *testing.T) {
+	timestamp := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		typ     string
+		labels  string
+		value   interface{}
+		want    interface{}
+		wantErr string
+	}{
+		{name: "Integer from string", typ: "int4", value: "42", want: int64(42)},
+		{name: "Integer from whole float", typ: "int8", value: 3.0, want: int64(3)},
+		{name: "Integer from fraction", typ: "int4", value: 3.5, wantErr: "expected an integer, got 3.5"},
+		{name: "Numeric keeps text", typ: "numeric", value: " 19.99 ", want: "19.99"},
+		{name: "Numeric from word", typ: "numeric", value: "cheap", wantErr: `expected a number, got "cheap"`},
+		{name: "Boolean from yes", typ: "bool", value: "yes", want: true},
+		{name: "Boolean from off", typ: "boolean", value: "off", want: false},
+		{name: "Boolean from 1", typ: "tinyint(1)", value: 1, want: true},
+		{name: "Boolean from expression", typ: "bool", value: int64(0), want: false},
+		{name: "Boolean from float", typ: "bool", value: 1.0, want: true},
+		{name: "Boolean from 2", typ: "bool", value: int64(2), wantErr: "expected a boolean, got 2"},
+		{name: "Boolean from word", typ: "bool", value: "maybe", wantErr: `expected a boolean, got "maybe"`},
+		{name: "Timestamp from now()", typ: "timestamptz", value: "2024-05-01T12:30:00Z", want: timestamp},
+		{name: "Timestamp with space", typ: "timestamp", value: "2024-05-01 12:30:00", want: timestamp},
+		{name: "Timestamp from word", typ: "timestamp", value: "tomorrow", wantErr: `expected a timestamp, got "tomorrow"`},
+		{name: "Date from timestamp", typ: "date", value: timestamp, want: "2024-05-01"},
+		{name: "Date from text", typ: "date", value: "2024-05-01", want: "2024-05-01"},
+		{name: "Text from number", typ: "text", value: 1234, want: "1234"},
+		{name: "Text from mapping", typ: "text", value: map[string]interface{}{"a": 1}, wantErr: "expected text, got a mapping"},
+		{name: "JSON from mapping", typ: "jsonb", value: map[string]interface{}{"tags": []interface{}{"a", 1}}, want: `{"tags":["a",1]}`},
+		{name: "JSON with integer keys", typ: "json", value: map[interface{}]interface{}{1: true}, want: `{"1":true}`},
+		{name: "JSON from document", typ: "jsonb", value: `{"a": 1}`, want: `{"a": 1}`},
+		{name: "JSON from invalid text", typ: "jsonb", value: "{a: 1}", wantErr: `expected a JSON document, got "{a: 1}"`},
+		{name: "Bytes from hex", typ: "bytea", value: `\xDEADbeef`, want: []byte{0xde, 0xad, 0xbe, 0xef}},
+		{name: "Bytes from base64", typ: "bytea", value: "aGk=", want: []byte("hi")},
+		{name: "Bytes from invalid text", typ: "blob", value: "not base64!", wantErr: "expected base64"},
+		{name: "UUID normalized", typ: "uuid", value: "6BA7B810-9DAD-11D1-80B4-00C04FD430C8", want: "6ba7b810-9dad-11d1-80b4-00c04fd430c8"},
+		{name: "UUID invalid", typ: "uuid", value: "123", wantErr: `expected a UUID, got "123"`},
+		{name: "Enum label", typ: "status", labels: "active\ninactive", value: "active", want: "active"},
+		{name: "Enum unknown label", typ: "status", labels: "active\ninactive", value: "pending", wantErr: `"pending" is not one of active, inactive`},
+		{name: "Array from list", typ: "int4[]", value: []interface{}{1, "2"}, want: pq.Array([]interface{}{int64(1), int64(2)})},
+		{name: "Array with invalid item", typ: "int4[]", value: []interface{}{1, "x"}, wantErr: `item 2: expected an integer, got "x"`},
+		{name: "Array from literal", typ: "text[]", value: "{a,b}", want: "{a,b}"},
+		{name: "Other passes through", typ: "inet", value: "10.0.0.1", want: "10.0.0.1"},
+		{name: "Other from list", typ: "inet", value: []interface{}{1}, wantErr: "expected a single value, got a list"},
+		{name: "Null", typ: "int4", value: nil, want: nil},
+		{name: "Default", typ: "int4", value: sqlDefault{}, want: sqlDefault{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := coerceValue(tt.value, parseColumnType(tt.typ, tt.labels))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("coerceValue() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("coerceValue() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("coerceValue() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoerceRowError(t *testing.T) {
+	table := &seedTable{
+		Columns:   []string{"name", "active"},
+		Types:     map[string]columnType{"active": parseColumnType("bool", "")},
+		Positions: make([]rowPosition, 3),
+	}
+	table.Positions[2] = rowPosition{
+		position: position{file: "seed.yaml", line: 12, column: 5},
+		cells:    map[string]position{"active": {file: "seed.yaml", line: 13, column: 13}},
+	}
+	err := coerceRow("users", table, 2, map[string]interface{}{"active": "maybe", "name": "John"})
+	want := `seed.yaml:13:13 users[3].active: invalid value for bool column: expected a boolean, got "maybe"`
+	if err == nil || err.Error() != want {
+		t.Errorf("coerceRow() error = %v, want %q", err, want)
+	}
+}
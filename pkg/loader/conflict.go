@@ -0,0 +1,88 @@
+package loader
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Conflict strategies decide what happens when an inserted row collides
+// with a row that already exists in the table
+const (
+	// conflictIgnore keeps the existing row (ON CONFLICT DO NOTHING)
+	conflictIgnore = "ignore"
+	// conflictUpsert updates the existing row (ON CONFLICT (key) DO UPDATE)
+	conflictUpsert = "upsert"
+	// conflictFail aborts the load with the database error
+	conflictFail = "fail"
+	// conflictReplace deletes the existing row by key before inserting
+	conflictReplace = "replace"
+)
+
+// validateConflict checks that a table's conflict strategy is known and
+// has the key columns it needs
+func validateConflict(table string, strategy string, key []string) error {
+	switch strategy {
+	case conflictIgnore, conflictFail:
+		return nil
+	case conflictUpsert, conflictReplace:
+		if len(key) == 0 {
+			return fmt.Errorf("table %s: on_conflict %s requires conflict_key columns", table, strategy)
+		}
+		for _, column := range key {
+			if err := validateColumnName(column); err != nil {
+				return fmt.Errorf("table %s: invalid conflict_key column: %w", table, err)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("table %s: unknown on_conflict strategy %q (use %s, %s, %s or %s)",
+			table, strategy, conflictIgnore, conflictUpsert, conflictFail, conflictReplace)
+	}
+}
+
+// onConflictClause returns the ON CONFLICT clause used by Postgres and
+// SQLite for the conflict strategy of a row with the given columns
+func onConflictClause(d dialect, strategy string, key []string, columns []string) string {
+	switch strategy {
+	case conflictIgnore:
+		return " ON CONFLICT DO NOTHING"
+	case conflictUpsert:
+		updates := updateColumns(d, key, columns)
+		// Nothing to update when the row only consists of key columns
+		if len(updates) == 0 {
+			return fmt.Sprintf(" ON CONFLICT (%s) DO NOTHING", quoteNames(d, key))
+		}
+		for i, column := range updates {
+			updates[i] = fmt.Sprintf("%s = EXCLUDED.%s", column, column)
+		}
+		return fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", quoteNames(d, key), strings.Join(updates, ", "))
+	default:
+		// fail and replace rely on the database to reject duplicates
+		return ""
+	}
+}
+
+// deleteStatement builds the DELETE statement that removes the existing row
+// matching the key columns of a row before it is replaced
+func deleteStatement(d dialect, table string, key []string, row map[string]interface{}) (string, []interface{}, error) {
+	where, values, err := keyCondition(d, key, row)
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("DELETE FROM %s WHERE %s", quoteName(d, table), where), values, nil
+}
+
+// keyCondition builds the WHERE condition matching the key columns of a row
+func keyCondition(d dialect, key []string, row map[string]interface{}) (string, []interface{}, error) {
+	conditions := make([]string, 0, len(key))
+	values := make([]interface{}, 0, len(key))
+	for i, column := range key {
+		v, ok := row[column]
+		if _, isDefault := v.(sqlDefault); !ok || isDefault {
+			return "", nil, fmt.Errorf("row has no value for conflict_key column %s", column)
+		}
+		conditions = append(conditions, fmt.Sprintf("%s = %s", quoteName(d, column), d.placeholder(i+1)))
+		values = append(values, v)
+	}
+	return strings.Join(conditions, " AND "), values, nil
+}
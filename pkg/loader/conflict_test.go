@@ -0,0 +1,66 @@
+package loader
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOnConflictClause(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		key      []string
+		columns  []string
+		want     string
+	}{
+		{name: "Ignore", strategy: conflictIgnore, key: []string{"id"}, columns: []string{"id", "name"}, want: " ON CONFLICT DO NOTHING"},
+		{name: "Upsert", strategy: conflictUpsert, key: []string{"id"}, columns: []string{"id", "name", "email"},
+			want: ` ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name", "email" = EXCLUDED."email"`},
+		{name: "Upsert with composite key", strategy: conflictUpsert, key: []string{"user_id", "role"}, columns: []string{"user_id", "role", "granted_at"},
+			want: ` ON CONFLICT ("user_id", "role") DO UPDATE SET "granted_at" = EXCLUDED."granted_at"`},
+		{name: "Upsert with only key columns", strategy: conflictUpsert, key: []string{"id"}, columns: []string{"id"}, want: ` ON CONFLICT ("id") DO NOTHING`},
+		{name: "Fail", strategy: conflictFail, key: []string{"id"}, columns: []string{"id"}, want: ""},
+		{name: "Replace", strategy: conflictReplace, key: []string{"id"}, columns: []string{"id"}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := onConflictClause(postgresDialect{}, tt.strategy, tt.key, tt.columns); got != tt.want {
+				t.Errorf("onConflictClause() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateConflict(t *testing.T) {
+	if err := validateConflict("users", conflictIgnore, nil); err != nil {
+		t.Errorf("validateConflict() error = %v", err)
+	}
+	if err := validateConflict("users", conflictUpsert, nil); err == nil {
+		t.Errorf("Expected error for upsert without key columns")
+	}
+	if err := validateConflict("users", "merge", []string{"id"}); err == nil {
+		t.Errorf("Expected error for unknown strategy")
+	}
+}
+
+func TestDeleteStatement(t *testing.T) {
+	stmt, values, err := deleteStatement(postgresDialect{}, "users", []string{"org_id", "email"}, map[string]interface{}{
+		"org_id": 3,
+		"email":  "john@example.com",
+		"name":   "John",
+	})
+	if err != nil {
+		t.Fatalf("deleteStatement() error = %v", err)
+	}
+	if want := `DELETE FROM "users" WHERE "org_id" = $1 AND "email" = $2`; stmt != want {
+		t.Errorf("deleteStatement() = %q, want %q", stmt, want)
+	}
+	if want := []interface{}{3, "john@example.com"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("deleteStatement() values = %v, want %v", values, want)
+	}
+
+	if _, _, err := deleteStatement(postgresDialect{}, "users", []string{"id"}, map[string]interface{}{"name": "John"}); err == nil {
+		t.Errorf("Expected error for row without key column")
+	}
+}
@@ -0,0 +1,210 @@
+package loader
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Modes for loading tables with COPY FROM STDIN
+const (
+	copyAuto   = "auto"
+	copyAlways = "always"
+	copyNever  = "never"
+)
+
+// stagingTable is the temporary table rows are copied into when the
+// conflict strategy needs an INSERT ... SELECT to apply ON CONFLICT
+const stagingTable = "dbload_copy"
+
+// validateCopyMode checks a copy mode
+func validateCopyMode(mode string) error {
+	switch mode {
+	case copyAuto, copyAlways, copyNever:
+		return nil
+	default:
+		return fmt.Errorf("unknown copy mode %q (use %s, %s or %s)", mode, copyAuto, copyAlways, copyNever)
+	}
+}
+
+// useCopy reports whether a table is loaded with COPY. COPY is only
+// available for Postgres and cannot insert column defaults, so it is not
+// used for rows that leave out columns under the default policy. In auto
+// mode it is only used for large tables.
+func useCopy(t *seedTable, opts insertOptions) bool {
+	if _, ok := opts.dialect.(postgresDialect); !ok {
+		return false
+	}
+	if len(t.Rows) == 0 || len(t.Columns) == 0 || opts.copyMode == copyNever {
+		return false
+	}
+	if opts.copyMode == copyAuto && len(t.Rows) < opts.copyThreshold {
+		return false
+	}
+	for _, row := range t.Rows {
+		for _, v := range row {
+			if _, ok := v.(sqlDefault); ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// copyTable loads the rows of a table with COPY FROM STDIN. With the fail
+// strategy the rows are copied straight into the table; the other strategies
+// copy into a temporary staging table and apply the conflict handling with
+// INSERT ... SELECT. Only the values from the seed file are recorded in the
+// store, since the rows are not returned by the database.
+func copyTable(db execer, table string, t *seedTable, opts insertOptions, store *rowStore) error {
+	d, dryRun := opts.dialect, opts.dryRun
+	rows := make([]map[string]interface{}, 0, len(t.Rows))
+	for i := range t.Rows {
+		rowOpts := opts
+		rowOpts.quiet = dryRun && t.generated(i, 1)
+		evaluated, err := evalRow(table, t, i, rowOpts)
+		if err != nil {
+			return err
+		}
+		if err := coerceRow(table, t, i, evaluated); err != nil {
+			return err
+		}
+		rows = append(rows, evaluated)
+	}
+	columns := t.Columns
+	columnList := quoteNames(d, columns)
+	quotedTable := quoteName(d, table)
+
+	target := table
+	var before, after []string
+	if t.OnConflict != conflictFail {
+		target = stagingTable
+		before = append(before, fmt.Sprintf("CREATE TEMP TABLE %s ON COMMIT DROP AS SELECT %s FROM %s WITH NO DATA", stagingTable, columnList, quotedTable))
+		if t.OnConflict == conflictReplace {
+			conditions := make([]string, len(t.ConflictKey))
+			for i, column := range t.ConflictKey {
+				conditions[i] = fmt.Sprintf("t.%s = s.%s", quoteName(d, column), quoteName(d, column))
+			}
+			after = append(after, fmt.Sprintf("DELETE FROM %s AS t USING %s AS s WHERE %s", quotedTable, stagingTable, strings.Join(conditions, " AND ")))
+		}
+		after = append(after,
+			fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s%s", quotedTable, columnList, columnList, stagingTable,
+				onConflictClause(d, t.OnConflict, t.ConflictKey, columns)),
+			fmt.Sprintf("DROP TABLE %s", stagingTable),
+		)
+	}
+
+	if dryRun {
+		for _, stmt := range before {
+			fmt.Fprintf(opts.out, "SQL: %s\n", stmt)
+		}
+		fmt.Fprintf(opts.out, "SQL: COPY %s (%s) FROM STDIN\n", quoteName(d, target), columnList)
+		fmt.Fprintf(opts.out, "Rows: %d\n", len(rows))
+		for _, stmt := range after {
+			fmt.Fprintf(opts.out, "SQL: %s\n", stmt)
+		}
+		fmt.Fprintln(opts.out, "---")
+	} else {
+		// COPY runs inside a transaction, so start one when loading without
+		tx, owned, err := copyTx(db)
+		if err != nil {
+			return t.dbRowError(table, 0, 0, "copy", err)
+		}
+		if owned {
+			defer tx.Rollback()
+		}
+
+		for _, stmt := range before {
+			if _, err := tx.Exec(stmt); err != nil {
+				return t.dbRowError(table, 0, 0, "copy", err)
+			}
+		}
+		if err := copyRows(tx, target, columns, rows); err != nil {
+			row := copyErrorRow(err)
+			return t.dbRowError(table, row, min(row, 1), "copy", err)
+		}
+		for _, stmt := range after {
+			if _, err := tx.Exec(stmt); err != nil {
+				return t.dbRowError(table, 0, 0, "copy", err)
+			}
+		}
+
+		if owned {
+			if err := tx.Commit(); err != nil {
+				return t.dbRowError(table, 0, 0, "copy", err)
+			}
+		}
+	}
+
+	for _, row := range rows {
+		store.add(table, row)
+	}
+	return nil
+}
+
+// copyErrorLine finds the line of the data in the context of a COPY error
+var copyErrorLine = regexp.MustCompile(`^COPY [^,]+, line (\d+)`)
+
+// copyErrorRow returns the 1-based row a COPY error occurred at, or 0 when
+// the error does not name a line. The data has no header, so each line holds
+// one row.
+func copyErrorRow(err error) int {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return 0
+	}
+	m := copyErrorLine.FindStringSubmatch(pqErr.Where)
+	if m == nil {
+		return 0
+	}
+	row, _ := strconv.Atoi(m[1])
+	return row
+}
+
+// copyRows streams rows into a table with COPY FROM STDIN
+func copyRows(tx *sql.Tx, table string, columns []string, rows []map[string]interface{}) error {
+	// The driver quotes the names itself, so pass them unquoted
+	parts, err := parseIdentifier(table, 2)
+	if err != nil {
+		return err
+	}
+	unquoted := make([]string, len(columns))
+	for i, column := range columns {
+		name, err := parseIdentifier(column, 1)
+		if err != nil {
+			return err
+		}
+		unquoted[i] = name[0]
+	}
+
+	copyStmt := pq.CopyIn(parts[0], unquoted...)
+	if len(parts) == 2 {
+		copyStmt = pq.CopyInSchema(parts[0], parts[1], unquoted...)
+	}
+	stmt, err := tx.Prepare(copyStmt)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	values := make([]interface{}, len(columns))
+	for _, row := range rows {
+		for i, column := range columns {
+			values[i] = row[column]
+		}
+		if _, err := stmt.Exec(values...); err != nil {
+			return err
+		}
+	}
+
+	// An Exec without arguments flushes the buffered rows
+	if _, err := stmt.Exec(); err != nil {
+		return err
+	}
+	return stmt.Close()
+}
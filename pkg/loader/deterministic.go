@@ -0,0 +1,18 @@
+package loader
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+)
+
+// cellRandom returns the source of randomness for a cell. It depends only
+// on the seed, the table, the row index and the column, so a cell keeps its
+// values as long as it stays at the same position in the same table.
+// Adding or removing a row shifts the index, and the values, of every later
+// row of the table.
+func cellRandom(seed int64, table string, row int, column string) *rand.Rand {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d\x00%s\x00%d\x00%s", seed, table, row, column)
+	return rand.New(rand.NewSource(int64(h.Sum64())))
+}
@@ -0,0 +1,42 @@
+package loader
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeterministicRows(t *testing.T) {
+	table := &seedTable{
+		Rows: []map[string]interface{}{
+			{"id": "${ uuid() }", "created_at": "${ now() }"},
+			{"id": "${ uuid() }", "created_at": "${ now() }"},
+		},
+		Columns: []string{"id", "created_at"},
+	}
+	seed := int64(7)
+	opts := insertOptions{seed: &seed, now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+
+	eval := func(table *seedTable, i int) map[string]interface{} {
+		row, err := evalRow("users", table, i, opts)
+		if err != nil {
+			t.Fatalf("evalRow() error = %v", err)
+		}
+		return row
+	}
+	first, second := eval(table, 0), eval(table, 1)
+	if again := eval(table, 0); again["id"] != first["id"] {
+		t.Errorf("uuid() = %v, then %v with the same seed", first["id"], again["id"])
+	}
+	if first["id"] == second["id"] {
+		t.Errorf("uuid() = %v in two rows", first["id"])
+	}
+	if first["created_at"] != "2024-05-01T12:00:00Z" {
+		t.Errorf("now() = %v, want the -now time", first["created_at"])
+	}
+
+	// Removing a row does not change the values generated for the others
+	shorter := &seedTable{Rows: table.Rows[:1], Columns: table.Columns}
+	if got := eval(shorter, 0); got["id"] != first["id"] {
+		t.Errorf("uuid() = %v, want %v", got["id"], first["id"])
+	}
+}
@@ -0,0 +1,200 @@
+package loader
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// dialect hides the differences in SQL syntax between the supported databases
+type dialect interface {
+	// name is the name of the database, as accepted by WithDriver
+	name() string
+	// driverName is the database/sql driver used to connect
+	driverName() string
+	// driverDSN converts the DATABASE_URL into the form the driver expects
+	driverDSN(dsn string) (string, error)
+
+	// placeholder returns the bind parameter for the n-th value, starting at 1
+	placeholder(n int) string
+	// quoteIdentifier quotes a single part of a table or column name
+	quoteIdentifier(name string) string
+	// maxParameters is the number of bind parameters allowed per statement
+	maxParameters() int
+	// supportsDefault reports whether DEFAULT can be used in a VALUES list
+	supportsDefault() bool
+
+	// insertStatement builds the statement inserting the rendered value
+	// tuples into table, applying the conflict strategy with key
+	insertStatement(table string, columns []string, tuples []string, strategy string, key []string) string
+	// returnsRows reports whether insertStatement returns the inserted rows
+	returnsRows() bool
+
+	// foreignKeyQuery lists the referencing and referenced table of every
+	// foreign key, or is empty when the tables cannot be ordered automatically
+	foreignKeyQuery() string
+	// columnTypeQuery returns the query listing the name, type and enum
+	// labels of every column of table, or an empty query when values are
+	// passed to the driver unconverted
+	columnTypeQuery(table string) (string, []interface{})
+	// primaryKeyQuery returns the query listing the columns of the primary
+	// key of table in key order
+	primaryKeyQuery(table string) (string, []interface{})
+	// deferConstraints is the statement that defers constraint checks to
+	// the end of the transaction, or empty when not supported
+	deferConstraints() string
+	// savepoint returns the statements that create, roll back to and
+	// release a savepoint; release is empty when not needed
+	savepoint(name string) (create, rollback, release string)
+
+	// truncateStatements returns the statements that empty the tables and
+	// restart their identity columns, or nil when not supported
+	truncateStatements(tables []string) []string
+	// truncateCommits reports whether truncateStatements commit the
+	// transaction implicitly, so that they must run before the load's
+	// transaction starts
+	truncateCommits() bool
+	// sequenceQuery returns the query listing the columns of table backed
+	// by a sequence with the name of the sequence, or an empty query when
+	// the database keeps its counters past the inserted values itself
+	sequenceQuery(table string) (string, []interface{})
+	// advanceSequence returns the statement that sets the sequence, the
+	// first parameter, to the largest value of column when the sequence
+	// would return that value or a smaller one next. It returns the new
+	// value of the sequence, or no row when the sequence is not moved.
+	advanceSequence(table, column string) string
+}
+
+// dialects lists the supported databases by name
+var dialects = map[string]dialect{
+	"postgres":  postgresDialect{},
+	"mysql":     mysqlDialect{},
+	"sqlite":    sqliteDialect{},
+	"sqlserver": sqlserverDialect{},
+}
+
+// dsnSchemes maps the URL schemes of DATABASE_URL to the databases
+var dsnSchemes = map[string]string{
+	"postgres":   "postgres",
+	"postgresql": "postgres",
+	"mysql":      "mysql",
+	"sqlite":     "sqlite",
+	"sqlite3":    "sqlite",
+	"file":       "sqlite",
+	"sqlserver":  "sqlserver",
+	"mssql":      "sqlserver",
+}
+
+// detectDialect selects the dialect named by driver, or the one matching
+// the scheme of the DSN when driver is empty. Without either, Postgres is
+// used, which also accepts key=value connection strings.
+func detectDialect(driver, dsn string) (dialect, error) {
+	if driver == "" {
+		driver = "postgres"
+		if i := strings.Index(dsn, ":"); i > 0 {
+			if name, ok := dsnSchemes[strings.ToLower(dsn[:i])]; ok {
+				driver = name
+			}
+		}
+	}
+
+	d, ok := dialects[driver]
+	if !ok {
+		return nil, fmt.Errorf("unsupported driver %q (use postgres, mysql, sqlite or sqlserver)", driver)
+	}
+	return d, nil
+}
+
+// DetectDriver returns the name of the database to load into: driver when
+// it is set, or the database the scheme of a DATABASE_URL names. Without
+// either, it is postgres, which also accepts key=value connection strings.
+func DetectDriver(driver, dsn string) (string, error) {
+	d, err := detectDialect(driver, dsn)
+	if err != nil {
+		return "", err
+	}
+	return d.name(), nil
+}
+
+// Open opens a connection to a DATABASE_URL with the driver of the named
+// database, as returned by DetectDriver
+func Open(driver, dsn string) (*sql.DB, error) {
+	d, err := detectDialect(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return openDatabase(d, dsn)
+}
+
+// openDatabase opens a connection with the driver of the dialect
+func openDatabase(d dialect, dsn string) (*sql.DB, error) {
+	driverDSN, err := d.driverDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DATABASE_URL for %s: %w", d.name(), err)
+	}
+	return sql.Open(d.driverName(), driverDSN)
+}
+
+// quoteName quotes every part of a validated table or column name. Names
+// that do not parse are quoted as a whole, so the result is always safe to
+// splice into a statement.
+func quoteName(d dialect, name string) string {
+	parts, err := parseIdentifier(name, 2)
+	if err != nil {
+		return d.quoteIdentifier(name)
+	}
+	for i, part := range parts {
+		parts[i] = d.quoteIdentifier(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// quoteNames quotes a list of column names and joins them with commas
+func quoteNames(d dialect, names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteName(d, name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// updateColumns returns the quoted non-key columns of an upsert, which are
+// updated with the new values when a row already exists
+func updateColumns(d dialect, key []string, columns []string) []string {
+	isKey := map[string]bool{}
+	for _, k := range key {
+		isKey[k] = true
+	}
+	var updates []string
+	for _, column := range columns {
+		if !isKey[column] {
+			updates = append(updates, quoteName(d, column))
+		}
+	}
+	return updates
+}
+
+// stripScheme removes the scheme prefix of a DSN, with or without slashes
+func stripScheme(dsn string, schemes ...string) string {
+	for _, scheme := range schemes {
+		for _, prefix := range []string{scheme + "://", scheme + ":"} {
+			if strings.HasPrefix(strings.ToLower(dsn), prefix) {
+				return dsn[len(prefix):]
+			}
+		}
+	}
+	return dsn
+}
+
+// parseURL parses a DSN written as a URL
+func parseURL(dsn string) (*url.URL, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing host in %q", u.Redacted())
+	}
+	return u, nil
+}
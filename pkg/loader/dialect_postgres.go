@@ -0,0 +1,105 @@
+package loader
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// postgresDialect generates SQL for PostgreSQL through lib/pq
+type postgresDialect struct{}
+
+func (postgresDialect) name() string       { return "postgres" }
+func (postgresDialect) driverName() string { return "postgres" }
+
+func (postgresDialect) driverDSN(dsn string) (string, error) {
+	return dsn, nil
+}
+
+func (postgresDialect) placeholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+func (postgresDialect) quoteIdentifier(name string) string {
+	return pq.QuoteIdentifier(name)
+}
+
+func (postgresDialect) maxParameters() int    { return 65535 }
+func (postgresDialect) supportsDefault() bool { return true }
+func (postgresDialect) returnsRows() bool     { return true }
+
+func (d postgresDialect) insertStatement(table string, columns []string, tuples []string, strategy string, key []string) string {
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s%s RETURNING *",
+		quoteName(d, table), quoteNames(d, columns), strings.Join(tuples, ", "), onConflictClause(d, strategy, key, columns))
+}
+
+// foreignKeyQuery renders table names relative to the search path, which
+// matches how tables are named in the seed file
+func (postgresDialect) foreignKeyQuery() string {
+	return `
+SELECT conrelid::regclass::text, confrelid::regclass::text
+FROM pg_constraint
+WHERE contype = 'f'`
+}
+
+// columnTypeQuery reports arrays as their element type followed by [] and
+// lists the labels of enums, one per line
+func (d postgresDialect) columnTypeQuery(table string) (string, []interface{}) {
+	return `
+SELECT a.attname,
+	CASE WHEN e.oid IS NULL THEN t.typname ELSE e.typname || '[]' END,
+	COALESCE((SELECT string_agg(l.enumlabel, E'\n' ORDER BY l.enumsortorder)
+		FROM pg_enum AS l WHERE l.enumtypid = COALESCE(e.oid, t.oid)), '')
+FROM pg_attribute AS a
+JOIN pg_type AS t ON t.oid = a.atttypid
+LEFT JOIN pg_type AS e ON e.oid = t.typelem AND t.typcategory = 'A'
+WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped`, []interface{}{quoteName(d, table)}
+}
+
+func (d postgresDialect) primaryKeyQuery(table string) (string, []interface{}) {
+	return `
+SELECT a.attname
+FROM pg_index AS i
+JOIN pg_attribute AS a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+WHERE i.indrelid = $1::regclass AND i.indisprimary
+ORDER BY array_position(i.indkey::int2[], a.attnum)`, []interface{}{quoteName(d, table)}
+}
+
+func (postgresDialect) deferConstraints() string {
+	return "SET CONSTRAINTS ALL DEFERRED"
+}
+
+func (postgresDialect) savepoint(name string) (string, string, string) {
+	return "SAVEPOINT " + name, "ROLLBACK TO SAVEPOINT " + name, "RELEASE SAVEPOINT " + name
+}
+
+// truncateStatements also truncates the tables referencing the tables
+func (d postgresDialect) truncateStatements(tables []string) []string {
+	return []string{fmt.Sprintf("TRUNCATE TABLE %s RESTART IDENTITY CASCADE", quoteNames(d, tables))}
+}
+
+func (postgresDialect) truncateCommits() bool {
+	return false
+}
+
+// sequenceQuery finds the sequences of serial and identity columns
+func (d postgresDialect) sequenceQuery(table string) (string, []interface{}) {
+	return `
+SELECT a.attname, pg_get_serial_sequence($1::text, a.attname)
+FROM pg_attribute AS a
+WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped
+	AND pg_get_serial_sequence($1::text, a.attname) IS NOT NULL
+ORDER BY a.attnum`, []interface{}{quoteName(d, table)}
+}
+
+// advanceSequence compares the largest value with the value the sequence
+// returns next: its last value plus one, or its start value before it was
+// first used
+func (d postgresDialect) advanceSequence(table, column string) string {
+	return fmt.Sprintf(`
+SELECT setval(s.seqrelid, m.max)
+FROM (SELECT MAX(%s) AS max FROM %s) AS m
+JOIN pg_sequence AS s ON s.seqrelid = $1::regclass
+WHERE m.max >= COALESCE(pg_sequence_last_value(s.seqrelid) + 1, s.seqstart)`, quoteName(d, column), quoteName(d, table))
+}
@@ -0,0 +1,137 @@
+package loader
+
+import (
+	"fmt"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteDialect generates SQL for SQLite through the pure Go modernc driver
+type sqliteDialect struct{}
+
+func (sqliteDialect) name() string       { return "sqlite" }
+func (sqliteDialect) driverName() string { return "sqlite" }
+
+// driverDSN turns sqlite://path into the file name the driver expects and
+// enables foreign key checks, which SQLite leaves off by default
+func (sqliteDialect) driverDSN(dsn string) (string, error) {
+	path := stripScheme(dsn, "sqlite3", "sqlite")
+	if path == "" {
+		return "", fmt.Errorf("missing database file")
+	}
+	if strings.Contains(path, "foreign_keys") {
+		return path, nil
+	}
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return path + separator + "_pragma=foreign_keys(1)", nil
+}
+
+func (sqliteDialect) placeholder(n int) string {
+	return "?"
+}
+
+func (sqliteDialect) quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func (sqliteDialect) maxParameters() int    { return 32766 }
+func (sqliteDialect) supportsDefault() bool { return false }
+func (sqliteDialect) returnsRows() bool     { return true }
+
+// insertStatement uses the same upsert syntax as Postgres, which SQLite
+// supports since version 3.24
+func (d sqliteDialect) insertStatement(table string, columns []string, tuples []string, strategy string, key []string) string {
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s%s RETURNING *",
+		quoteName(d, table), quoteNames(d, columns), strings.Join(tuples, ", "), onConflictClause(d, strategy, key, columns))
+}
+
+func (sqliteDialect) foreignKeyQuery() string {
+	return `
+SELECT m.name, p."table"
+FROM sqlite_master AS m
+JOIN pragma_foreign_key_list(m.name) AS p
+WHERE m.type = 'table'`
+}
+
+// columnTypeQuery returns the declared types, which SQLite does not enforce
+func (sqliteDialect) columnTypeQuery(table string) (string, []interface{}) {
+	schema, name := "main", table
+	if parts, err := parseIdentifier(table, 2); err == nil {
+		name = parts[len(parts)-1]
+		if len(parts) == 2 {
+			schema = parts[0]
+		}
+	}
+	return `SELECT name, type, '' FROM pragma_table_info(?, ?)`, []interface{}{name, schema}
+}
+
+func (sqliteDialect) primaryKeyQuery(table string) (string, []interface{}) {
+	schema, name := "main", table
+	if parts, err := parseIdentifier(table, 2); err == nil {
+		name = parts[len(parts)-1]
+		if len(parts) == 2 {
+			schema = parts[0]
+		}
+	}
+	return `SELECT name FROM pragma_table_info(?, ?) WHERE pk > 0 ORDER BY pk`, []interface{}{name, schema}
+}
+
+func (sqliteDialect) deferConstraints() string {
+	return "PRAGMA defer_foreign_keys = ON"
+}
+
+func (sqliteDialect) savepoint(name string) (string, string, string) {
+	return "SAVEPOINT " + name, "ROLLBACK TO SAVEPOINT " + name, "RELEASE SAVEPOINT " + name
+}
+
+// truncateStatements deletes the rows, since SQLite has no TRUNCATE. The
+// tables are emptied in reverse, so that rows are deleted before the rows
+// they are referenced by when the tables are listed in load order. Their
+// AUTOINCREMENT counters are restarted by resetSequences.
+func (d sqliteDialect) truncateStatements(tables []string) []string {
+	stmts := make([]string, 0, len(tables))
+	for i := len(tables) - 1; i >= 0; i-- {
+		stmts = append(stmts, "DELETE FROM "+quoteName(d, tables[i]))
+	}
+	return stmts
+}
+
+func (sqliteDialect) truncateCommits() bool {
+	return false
+}
+
+// resetSequences returns the statement that restarts the AUTOINCREMENT
+// counters of the tables by removing them from sqlite_sequence. It is empty
+// when no table uses AUTOINCREMENT, since SQLite only creates
+// sqlite_sequence for the first such table.
+func (sqliteDialect) resetSequences(db execer, tables []string) (string, error) {
+	rows, err := db.Query("SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'sqlite_sequence'")
+	if err != nil {
+		return "", err
+	}
+	exists := rows.Next()
+	rows.Close()
+	if err := rows.Err(); err != nil || !exists {
+		return "", err
+	}
+
+	names := make([]string, len(tables))
+	for i, table := range tables {
+		names[i] = "'" + strings.ReplaceAll(table, "'", "''") + "'"
+	}
+	return fmt.Sprintf("DELETE FROM sqlite_sequence WHERE name IN (%s)", strings.Join(names, ", ")), nil
+}
+
+// sequenceQuery is empty, since rowids and AUTOINCREMENT counters move past
+// explicitly inserted values
+func (sqliteDialect) sequenceQuery(string) (string, []interface{}) {
+	return "", nil
+}
+
+func (sqliteDialect) advanceSequence(string, string) string {
+	return ""
+}
@@ -0,0 +1,133 @@
+package loader
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	_ "github.com/microsoft/go-mssqldb"
+)
+
+// sqlserverDialect generates SQL for Microsoft SQL Server
+type sqlserverDialect struct{}
+
+func (sqlserverDialect) name() string       { return "sqlserver" }
+func (sqlserverDialect) driverName() string { return "sqlserver" }
+
+// driverDSN accepts the mssql:// scheme as an alias of sqlserver://
+func (sqlserverDialect) driverDSN(dsn string) (string, error) {
+	if strings.HasPrefix(strings.ToLower(dsn), "mssql://") {
+		return "sqlserver://" + dsn[len("mssql://"):], nil
+	}
+	return dsn, nil
+}
+
+func (sqlserverDialect) placeholder(n int) string {
+	return fmt.Sprintf("@p%d", n)
+}
+
+func (sqlserverDialect) quoteIdentifier(name string) string {
+	return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+}
+
+func (sqlserverDialect) maxParameters() int { return 2100 }
+
+// supportsDefault is false because DEFAULT is not allowed in the source
+// rows of a MERGE statement
+func (sqlserverDialect) supportsDefault() bool { return false }
+func (sqlserverDialect) returnsRows() bool     { return true }
+
+// insertStatement has no ON CONFLICT clause to work with, so the ignore and
+// upsert strategies are written as a MERGE on the key columns. Rows without
+// a value for every key column cannot be matched by the MERGE, so they are
+// inserted with a plain INSERT.
+func (d sqlserverDialect) insertStatement(table string, columns []string, tuples []string, strategy string, key []string) string {
+	quotedTable := quoteName(d, table)
+	columnList := quoteNames(d, columns)
+	values := strings.Join(tuples, ", ")
+
+	hasKey := len(key) > 0
+	for _, column := range key {
+		hasKey = hasKey && slices.Contains(columns, column)
+	}
+	if (strategy != conflictIgnore && strategy != conflictUpsert) || !hasKey {
+		return fmt.Sprintf("INSERT INTO %s (%s) OUTPUT inserted.* VALUES %s", quotedTable, columnList, values)
+	}
+
+	conditions := make([]string, len(key))
+	for i, column := range key {
+		quoted := quoteName(d, column)
+		conditions[i] = fmt.Sprintf("target.%s = source.%s", quoted, quoted)
+	}
+	sourceColumns := make([]string, len(columns))
+	for i, column := range columns {
+		sourceColumns[i] = "source." + quoteName(d, column)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "MERGE INTO %s AS target USING (VALUES %s) AS source (%s) ON %s",
+		quotedTable, values, columnList, strings.Join(conditions, " AND "))
+	if updates := updateColumns(d, key, columns); strategy == conflictUpsert && len(updates) > 0 {
+		for i, column := range updates {
+			updates[i] = fmt.Sprintf("%s = source.%s", column, column)
+		}
+		fmt.Fprintf(&b, " WHEN MATCHED THEN UPDATE SET %s", strings.Join(updates, ", "))
+	}
+	fmt.Fprintf(&b, " WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s) OUTPUT inserted.*;",
+		columnList, strings.Join(sourceColumns, ", "))
+	return b.String()
+}
+
+func (sqlserverDialect) foreignKeyQuery() string {
+	return `
+SELECT OBJECT_NAME(parent_object_id), OBJECT_NAME(referenced_object_id)
+FROM sys.foreign_keys`
+}
+
+func (d sqlserverDialect) columnTypeQuery(table string) (string, []interface{}) {
+	return `
+SELECT c.name, t.name, ''
+FROM sys.columns AS c
+JOIN sys.types AS t ON t.user_type_id = c.user_type_id
+WHERE c.object_id = OBJECT_ID(@p1)`, []interface{}{quoteName(d, table)}
+}
+
+func (d sqlserverDialect) primaryKeyQuery(table string) (string, []interface{}) {
+	return `
+SELECT c.name
+FROM sys.indexes AS i
+JOIN sys.index_columns AS ic ON ic.object_id = i.object_id AND ic.index_id = i.index_id
+JOIN sys.columns AS c ON c.object_id = ic.object_id AND c.column_id = ic.column_id
+WHERE i.is_primary_key = 1 AND i.object_id = OBJECT_ID(@p1)
+ORDER BY ic.key_ordinal`, []interface{}{quoteName(d, table)}
+}
+
+// deferConstraints is not supported, since SQL Server checks foreign keys
+// immediately
+func (sqlserverDialect) deferConstraints() string {
+	return ""
+}
+
+func (sqlserverDialect) savepoint(name string) (string, string, string) {
+	return "SAVE TRANSACTION " + name, "ROLLBACK TRANSACTION " + name, ""
+}
+
+// truncateStatements is not supported, since SQL Server cannot truncate
+// tables referenced by foreign keys
+func (sqlserverDialect) truncateStatements([]string) []string {
+	return nil
+}
+
+func (sqlserverDialect) truncateCommits() bool {
+	return false
+}
+
+// sequenceQuery is empty, since identity columns move past explicitly
+// inserted values
+func (sqlserverDialect) sequenceQuery(string) (string, []interface{}) {
+	return "", nil
+}
+
+func (sqlserverDialect) advanceSequence(string, string) string {
+	return ""
+}
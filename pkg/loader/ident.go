@@ -0,0 +1,145 @@
+package loader
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxIdentifierLength is the length at which Postgres truncates identifiers
+const maxIdentifierLength = 63
+
+// positionError is an error at a line and column of the seed file
+type positionError struct {
+	line   int
+	column int
+	err    error
+}
+
+func (e *positionError) Error() string {
+	return fmt.Sprintf("%d:%d: %v", e.line, e.column, e.err)
+}
+
+func (e *positionError) Unwrap() error {
+	return e.err
+}
+
+// nodeError attaches the position of a YAML node to an error
+func nodeError(node *yaml.Node, err error) error {
+	return &positionError{line: node.Line, column: node.Column, err: err}
+}
+
+// fileError prefixes an error with the path of the seed file, in the
+// path:line:column form when the error has a position
+func fileError(path string, err error) error {
+	if _, ok := err.(*positionError); ok {
+		return fmt.Errorf("%s:%w", path, err)
+	}
+	return fmt.Errorf("%s: %w", path, err)
+}
+
+// parseIdentifier splits a possibly qualified name into at most maxParts
+// dot-separated parts. Each part is either a plain identifier made of
+// letters, digits, underscores and dollar signs that does not start with a
+// digit, or a double-quoted identifier in which "" stands for a quote.
+// Parts keep their case, so that mixed-case names match quoted names in the schema.
+func parseIdentifier(name string, maxParts int) ([]string, error) {
+	var parts []string
+	rest := name
+	for {
+		var part string
+		if strings.HasPrefix(rest, `"`) {
+			// Quoted identifier: read up to the closing quote, unescaping ""
+			var b strings.Builder
+			i := 1
+			for {
+				if i >= len(rest) {
+					return nil, fmt.Errorf("unterminated quoted identifier in %q", name)
+				}
+				if rest[i] == '"' {
+					if i+1 < len(rest) && rest[i+1] == '"' {
+						b.WriteByte('"')
+						i += 2
+						continue
+					}
+					break
+				}
+				b.WriteByte(rest[i])
+				i++
+			}
+			part = b.String()
+			rest = rest[i+1:]
+			if part == "" || strings.ContainsRune(part, 0) {
+				return nil, fmt.Errorf("invalid quoted identifier in %q", name)
+			}
+		} else {
+			end := strings.IndexByte(rest, '.')
+			if end < 0 {
+				end = len(rest)
+			}
+			part = rest[:end]
+			rest = rest[end:]
+			if !isPlainIdentifier(part) {
+				return nil, fmt.Errorf("%q is not a valid identifier (use letters, digits, _ and $, or double quotes)", name)
+			}
+		}
+
+		if len(part) > maxIdentifierLength {
+			return nil, fmt.Errorf("identifier %q is longer than %d bytes", part, maxIdentifierLength)
+		}
+		parts = append(parts, part)
+
+		if rest == "" {
+			break
+		}
+		if rest[0] != '.' {
+			return nil, fmt.Errorf("unexpected %q after identifier in %q", rest, name)
+		}
+		rest = rest[1:]
+	}
+
+	if len(parts) > maxParts {
+		return nil, fmt.Errorf("%q has more than %d dot-separated parts", name, maxParts)
+	}
+	return parts, nil
+}
+
+// isPlainIdentifier reports whether s can be written without quotes
+func isPlainIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_' || unicode.IsLetter(r):
+		case i > 0 && (r == '$' || unicode.IsDigit(r)):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// validateTableName checks a table name, which may be qualified with a schema
+func validateTableName(name string) error {
+	_, err := parseIdentifier(name, 2)
+	return err
+}
+
+// validateColumnName checks a column name
+func validateColumnName(name string) error {
+	_, err := parseIdentifier(name, 1)
+	return err
+}
+
+// canonicalName returns the parts of a name joined by dots, without quotes,
+// so that differently quoted spellings of the same name compare equal
+func canonicalName(name string) string {
+	parts, err := parseIdentifier(name, 2)
+	if err != nil {
+		return name
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,64 @@
+package loader
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseIdentifier(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		maxParts int
+		want     []string
+		wantErr  bool
+	}{
+		{name: "Plain name", input: "users", maxParts: 2, want: []string{"users"}},
+		{name: "Reserved word", input: "order", maxParts: 2, want: []string{"order"}},
+		{name: "Mixed case", input: "UserAccounts", maxParts: 2, want: []string{"UserAccounts"}},
+		{name: "Schema qualified", input: "billing.invoices", maxParts: 2, want: []string{"billing", "invoices"}},
+		{name: "Quoted with dot and quote", input: `"weird.name ""x"""`, maxParts: 1, want: []string{`weird.name "x"`}},
+		{name: "Quoted schema", input: `"My Schema".items`, maxParts: 2, want: []string{"My Schema", "items"}},
+		{name: "Dollar and digits", input: "col$1", maxParts: 1, want: []string{"col$1"}},
+		{name: "Too many parts", input: "a.b.c", maxParts: 2, wantErr: true},
+		{name: "Qualified column", input: "users.id", maxParts: 1, wantErr: true},
+		{name: "Injection", input: "id) VALUES (1); DROP TABLE users; --", maxParts: 1, wantErr: true},
+		{name: "Leading digit", input: "1st", maxParts: 1, wantErr: true},
+		{name: "Empty", input: "", maxParts: 1, wantErr: true},
+		{name: "Empty part", input: "billing.", maxParts: 2, wantErr: true},
+		{name: "Unterminated quote", input: `"users`, maxParts: 1, wantErr: true},
+		{name: "Text after quote", input: `"users"x`, maxParts: 1, wantErr: true},
+		{name: "Too long", input: strings.Repeat("a", 64), maxParts: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseIdentifier(tt.input, tt.maxParts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseIdentifier() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseIdentifier() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvalidColumnPosition(t *testing.T) {
+	input := `
+- id: 1
+  "name; DROP TABLE users": x
+`
+	var table seedTable
+	err := yaml.Unmarshal([]byte(input), &table)
+	if err == nil {
+		t.Fatalf("Expected error for invalid column name")
+	}
+	if !strings.HasPrefix(err.Error(), "3:3: invalid column name") {
+		t.Errorf("Expected error with line and column, got %v", err)
+	}
+}
@@ -0,0 +1,649 @@
+// Package loader loads YAML seed files into a database.
+//
+// A Loader is configured with options and loads seed files from the file
+// system, from memory or from an fs.FS:
+//
+//	l, err := loader.New(loader.WithDB(db), loader.WithConflict("upsert", "id"))
+//	if err != nil {
+//		return err
+//	}
+//	result, err := l.LoadFile(ctx, "testdata/seed.yaml")
+//
+// LoadFile, LoadBytes and LoadFS also exist as functions for a single load,
+// such as loader.LoadFile(t.Context(), tx, "testdata/seed.yaml") in a test.
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tendant/dbload/pkg/value"
+)
+
+// bytesName is the file name errors report for seed data loaded with LoadBytes
+const bytesName = "input"
+
+// DB is a database handle rows are loaded with: a *sql.DB, or a *sql.Tx or
+// *sql.Conn the load runs in
+type DB interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Loader loads seed files into a database. A Loader can be used for any
+// number of loads, but not for several at the same time.
+type Loader struct {
+	db      DB
+	driver  string
+	dialect dialect
+	dryRun  bool
+	// out receives the statements of a dry run, and log the progress
+	out io.Writer
+	log io.Writer
+
+	order            []string
+	respectYAMLOrder bool
+	autoOrder        bool
+
+	useTx            bool
+	deferConstraints bool
+	savepoints       bool
+
+	onConflict    string
+	conflictKey   []string
+	missing       string
+	batchSize     int
+	copyMode      string
+	copyThreshold int
+	// truncate empties the tables before loading, only those listed in
+	// truncateOnly when it is set
+	truncate     bool
+	truncateOnly []string
+
+	legacyExpressions bool
+	seed              *int64
+	now               time.Time
+	locale            string
+	// registry holds the functions of the seed files; each load copies it
+	// and registers functions and ref in the copy
+	registry  *value.Registry
+	functions map[string]value.Function
+}
+
+// Option configures a Loader
+type Option func(*Loader)
+
+// WithDB sets the database to load into. Loads into a *sql.DB run in a
+// transaction of their own; loads into a *sql.Tx run in that transaction,
+// which the caller commits.
+func WithDB(db DB) Option {
+	return func(l *Loader) { l.db = db }
+}
+
+// WithDriver sets the database the SQL is written for: postgres (the
+// default), mysql, sqlite or sqlserver
+func WithDriver(name string) Option {
+	return func(l *Loader) { l.driver = name }
+}
+
+// WithDryRun prints the statements to w instead of executing them. No
+// database is needed, unless the tables are ordered by their foreign keys.
+func WithDryRun(w io.Writer) Option {
+	return func(l *Loader) { l.dryRun, l.out = true, w }
+}
+
+// WithLog writes a line to w for every table loaded
+func WithLog(w io.Writer) Option {
+	return func(l *Loader) { l.log = w }
+}
+
+// WithOrder loads the listed tables first, in the given order
+func WithOrder(tables ...string) Option {
+	return func(l *Loader) { l.order = tables }
+}
+
+// WithYAMLOrder sets whether tables are loaded in the order they appear in
+// the seed files (the default) or in an arbitrary order
+func WithYAMLOrder(respect bool) Option {
+	return func(l *Loader) { l.respectYAMLOrder = respect }
+}
+
+// WithAutoOrder orders the tables by the foreign keys in the database schema
+func WithAutoOrder() Option {
+	return func(l *Loader) { l.autoOrder = true }
+}
+
+// WithoutTransaction executes every statement on its own instead of in a
+// single transaction that is rolled back on failure
+func WithoutTransaction() Option {
+	return func(l *Loader) { l.useTx = false }
+}
+
+// WithDeferredConstraints defers deferrable constraints until the
+// transaction commits
+func WithDeferredConstraints() Option {
+	return func(l *Loader) { l.deferConstraints = true }
+}
+
+// WithSavepoints loads each table in a savepoint and skips the tables that
+// fail to load
+func WithSavepoints() Option {
+	return func(l *Loader) { l.savepoints = true }
+}
+
+// WithConflict sets the conflict strategy of the tables that do not set
+// their own: ignore (the default), upsert, fail or replace, with the key
+// columns used by upsert and replace (by default id)
+func WithConflict(strategy string, key ...string) Option {
+	return func(l *Loader) {
+		l.onConflict = strategy
+		if len(key) > 0 {
+			l.conflictKey = key
+		}
+	}
+}
+
+// WithMissing sets the policy for the columns a row leaves out: default
+// (the default) or null
+func WithMissing(policy string) Option {
+	return func(l *Loader) { l.missing = policy }
+}
+
+// WithBatchSize sets the maximum number of rows per INSERT statement
+func WithBatchSize(n int) Option {
+	return func(l *Loader) { l.batchSize = n }
+}
+
+// WithCopy selects when tables are loaded with COPY FROM STDIN: auto (the
+// default, for tables with at least threshold rows), always or never
+func WithCopy(mode string, threshold int) Option {
+	return func(l *Loader) { l.copyMode, l.copyThreshold = mode, threshold }
+}
+
+// WithTruncate empties the tables before loading them and restarts their
+// identity columns: every table of the seed files, or only the given ones
+func WithTruncate(tables ...string) Option {
+	return func(l *Loader) { l.truncate, l.truncateOnly = true, tables }
+}
+
+// WithLegacyExpressions evaluates every string containing parentheses or a
+// pipe, as older versions did
+func WithLegacyExpressions() Option {
+	return func(l *Loader) { l.legacyExpressions = true }
+}
+
+// WithSeed makes random values such as uuid() and bcrypt salts the same on
+// every load
+func WithSeed(seed int64) Option {
+	return func(l *Loader) { l.seed = &seed }
+}
+
+// WithNow freezes the time returned by now() and used by other functions
+func WithNow(now time.Time) Option {
+	return func(l *Loader) { l.now = now }
+}
+
+// WithLocale selects the locale of the fake.* functions, such as de_DE
+func WithLocale(locale string) Option {
+	return func(l *Loader) { l.locale = locale }
+}
+
+// WithRegistry sets the functions available to the values of the seed
+// files, value.Default() by default. Each load uses a copy of r, so the
+// functions registered by the Loader do not change it.
+func WithRegistry(r *value.Registry) Option {
+	return func(l *Loader) { l.registry = r }
+}
+
+// WithFunction registers a function for the values of the seed files
+func WithFunction(name string, fn value.Function) Option {
+	return func(l *Loader) { l.functions[name] = fn }
+}
+
+// New returns a Loader configured with the options
+func New(opts ...Option) (*Loader, error) {
+	l := &Loader{
+		log:              io.Discard,
+		respectYAMLOrder: true,
+		useTx:            true,
+		onConflict:       conflictIgnore,
+		conflictKey:      []string{refKeyColumn},
+		missing:          missingDefault,
+		batchSize:        1,
+		copyMode:         copyAuto,
+		copyThreshold:    10000,
+		locale:           "en_US",
+		registry:         value.Default(),
+		functions:        map[string]value.Function{},
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	d, err := detectDialect(l.driver, "")
+	if err != nil {
+		return nil, err
+	}
+	l.dialect = d
+	if l.out == nil {
+		l.out = io.Discard
+	}
+	if l.log == nil {
+		l.log = io.Discard
+	}
+	if (l.deferConstraints || l.savepoints) && !l.useTx {
+		return nil, errors.New("deferred constraints and savepoints require a transaction")
+	}
+	if l.missing != missingDefault && l.missing != missingNull {
+		return nil, fmt.Errorf("unknown missing policy %q (use %s or %s)", l.missing, missingDefault, missingNull)
+	}
+	if err := validateCopyMode(l.copyMode); err != nil {
+		return nil, err
+	}
+	if l.truncate && l.dialect.truncateStatements(nil) == nil {
+		return nil, fmt.Errorf("truncating tables is not supported for %s", l.dialect.name())
+	}
+	if _, ok := l.db.(*sql.Tx); ok && l.truncate && l.dialect.truncateCommits() {
+		return nil, fmt.Errorf("truncating tables commits implicitly on %s, so it cannot run in the caller's transaction", l.dialect.name())
+	}
+	if !slices.Contains(value.Locales(), l.locale) {
+		return nil, fmt.Errorf("unsupported locale %q (use %s)", l.locale, strings.Join(value.Locales(), ", "))
+	}
+	if l.db == nil && (!l.dryRun || l.autoOrder) {
+		return nil, errors.New("a database is required (or use a dry run without automatic ordering)")
+	}
+	return l, nil
+}
+
+// Result describes a load
+type Result struct {
+	// Tables lists the tables in the order they were processed
+	Tables []TableResult
+	// Sequences lists the sequences that were behind the values loaded
+	// into their columns and were advanced past them
+	Sequences []SequenceResult
+}
+
+// TableResult describes the load of a table
+type TableResult struct {
+	Name string
+	// Rows holds the rows as inserted, with the columns filled in by the
+	// database when it returns them, such as generated ids
+	Rows []map[string]interface{}
+	// Skipped is the error the table failed with when it was skipped in
+	// savepoint mode
+	Skipped error
+	// Removed is the number of rows deleted from the table by CleanFile
+	Removed int64
+	// Duration is how long the table took to load
+	Duration time.Duration
+}
+
+// Table returns the result of the table with the given name, or nil when
+// the table was not loaded
+func (r *Result) Table(name string) *TableResult {
+	for i := range r.Tables {
+		if r.Tables[i].Name == name {
+			return &r.Tables[i]
+		}
+	}
+	return nil
+}
+
+// LoadFile loads the seed files matching each path, which may be a file, a
+// directory or a glob
+func (l *Loader) LoadFile(ctx context.Context, paths ...string) (*Result, error) {
+	s := newSeedLoader(seedFS{})
+	if err := s.loadPaths(paths...); err != nil {
+		return nil, err
+	}
+	return masked(l.load(ctx, s))
+}
+
+// LoadBytes loads a seed file held in memory. Files it includes are read
+// relative to the working directory.
+func (l *Loader) LoadBytes(ctx context.Context, data []byte) (*Result, error) {
+	s := newSeedLoader(seedFS{})
+	if err := s.parse(bytesName, data); err != nil {
+		return nil, err
+	}
+	return masked(l.load(ctx, s))
+}
+
+// LoadFS loads the seed files of fsys matching each path, such as the
+// files embedded with go:embed
+func (l *Loader) LoadFS(ctx context.Context, fsys fs.FS, paths ...string) (*Result, error) {
+	s := newSeedLoader(seedFS{fsys: fsys})
+	if err := s.loadPaths(paths...); err != nil {
+		return nil, err
+	}
+	return masked(l.load(ctx, s))
+}
+
+// LoadFile loads a seed file into db with a Loader configured by the options
+func LoadFile(ctx context.Context, db DB, path string, opts ...Option) (*Result, error) {
+	l, err := New(append([]Option{WithDB(db)}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	return l.LoadFile(ctx, path)
+}
+
+// LoadBytes loads a seed file held in memory into db with a Loader
+// configured by the options
+func LoadBytes(ctx context.Context, db DB, data []byte, opts ...Option) (*Result, error) {
+	l, err := New(append([]Option{WithDB(db)}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	return l.LoadBytes(ctx, data)
+}
+
+// LoadFS loads a seed file of fsys into db with a Loader configured by the
+// options
+func LoadFS(ctx context.Context, db DB, fsys fs.FS, path string, opts ...Option) (*Result, error) {
+	l, err := New(append([]Option{WithDB(db)}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	return l.LoadFS(ctx, fsys, path)
+}
+
+// prepare applies the defaults to the tables of the seed files and returns
+// the order to process them in, sorted by their foreign keys when autoOrder
+// is set
+func (l *Loader) prepare(ctx context.Context, s *seedLoader, autoOrder bool) ([]string, error) {
+	for table, t := range s.tables {
+		if t.OnConflict == "" {
+			t.OnConflict = l.onConflict
+		}
+		if len(t.ConflictKey) == 0 {
+			t.ConflictKey = l.conflictKey
+		}
+		if err := validateConflict(table, t.OnConflict, t.ConflictKey); err != nil {
+			return nil, err
+		}
+		if t.Missing == "" {
+			t.Missing = l.missing
+		}
+		if err := normalizeRows(table, t); err != nil {
+			return nil, err
+		}
+	}
+	return l.tableOrder(ctx, s.tables, s.order, autoOrder)
+}
+
+// tableOrder returns every table of the seed files in the order they are
+// processed
+func (l *Loader) tableOrder(ctx context.Context, seedData map[string]*seedTable, yamlOrder []string, autoOrder bool) ([]string, error) {
+	tableOrder := yamlOrder
+	respectYamlOrder := l.respectYAMLOrder
+
+	// Process tables in specified order if provided
+	if len(l.order) > 0 {
+		// The explicit order takes precedence
+		tableOrder = l.order
+		respectYamlOrder = false // Override YAML order when explicit order is provided
+	}
+
+	// Sort every table in the seed file by its foreign keys, using the
+	// explicit order followed by the YAML order to break ties
+	if autoOrder {
+		var tables []string
+		seen := map[string]bool{}
+		for _, table := range append(slices.Clone(tableOrder), yamlOrder...) {
+			if _, ok := seedData[table]; ok && !seen[table] {
+				tables = append(tables, table)
+				seen[table] = true
+			}
+		}
+
+		deps, err := loadForeignKeys(contextConn{ctx: ctx, db: l.db}, l.dialect)
+		if err != nil {
+			return nil, err
+		}
+		deps = matchTableNames(tables, deps)
+		tableOrder, err = sortTables(tables, deps)
+		switch {
+		case err == nil:
+		case l.deferConstraints:
+			// Deferred constraints are only checked at commit, so the
+			// tables can be loaded in any order
+			fmt.Fprintf(l.log, "Warning: %v; relying on deferred constraints\n", err)
+			tableOrder = tables
+		case !l.autoOrder:
+			// Cleaning sorts the tables without WithAutoOrder, and keeps
+			// the order of the seed files when they cannot be sorted
+			fmt.Fprintf(l.log, "Warning: %v; keeping the order of the seed files\n", err)
+			tableOrder = tables
+		default:
+			return nil, err
+		}
+	}
+
+	// Process tables in the specified order
+	var order []string
+	seen := map[string]bool{}
+	if len(tableOrder) > 0 && (respectYamlOrder || len(l.order) > 0 || autoOrder) {
+		for _, table := range tableOrder {
+			if _, ok := seedData[table]; !ok {
+				fmt.Fprintf(l.log, "Warning: Table '%s' in order but not found in YAML data\n", table)
+				continue
+			}
+			if !seen[table] {
+				order = append(order, table)
+				seen[table] = true
+			}
+		}
+	}
+
+	// Process any remaining tables not specified in the order, in the
+	// order of the seed files
+	for _, table := range yamlOrder {
+		if _, ok := seedData[table]; ok && !seen[table] {
+			order = append(order, table)
+			seen[table] = true
+		}
+	}
+	return order, nil
+}
+
+// insertOptions returns the options for inserting the rows of the tables,
+// whose values call the functions of registry
+func (l *Loader) insertOptions(registry *value.Registry) insertOptions {
+	return insertOptions{
+		dialect:       l.dialect,
+		functions:     registry,
+		dryRun:        l.dryRun,
+		out:           l.out,
+		batchSize:     l.batchSize,
+		copyMode:      l.copyMode,
+		copyThreshold: l.copyThreshold,
+
+		legacyExpressions: l.legacyExpressions,
+		seed:              l.seed,
+		now:               l.now,
+		locale:            l.locale,
+	}
+}
+
+// Functions returns the functions available to the values of the seed
+// files, including those registered with WithFunction and ref
+func (l *Loader) Functions() *value.Registry {
+	return l.newRegistry(newRowStore())
+}
+
+// newRegistry returns a copy of the registry of the Loader with its
+// functions and the ref function backed by the rows of the store
+func (l *Loader) newRegistry(store *rowStore) *value.Registry {
+	r := l.registry.Clone()
+	for name, fn := range l.functions {
+		r.Register(name, fn)
+	}
+	r.Register("ref", store.refFunction())
+	return r
+}
+
+// begin returns the connection the statements of a load run on. When the
+// load runs in a transaction of its own, tx is that transaction; inTx
+// reports whether the statements run in a transaction at all.
+func (l *Loader) begin(ctx context.Context) (conn execer, tx *sql.Tx, inTx bool, err error) {
+	if l.dryRun {
+		return nil, nil, false, nil
+	}
+	if callerTx, ok := l.db.(*sql.Tx); ok {
+		if l.deferConstraints {
+			if err := deferConstraints(ctx, callerTx, l.dialect); err != nil {
+				return nil, nil, false, err
+			}
+		}
+		return contextConn{ctx: ctx, db: callerTx}, nil, true, nil
+	}
+	db, ok := l.db.(beginner)
+	if !l.useTx || !ok {
+		return contextConn{ctx: ctx, db: l.db}, nil, false, nil
+	}
+	tx, err = beginLoad(ctx, db, l.dialect, l.deferConstraints)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return contextConn{ctx: ctx, db: tx}, tx, true, nil
+}
+
+// load loads the tables read by s
+func (l *Loader) load(ctx context.Context, s *seedLoader) (*Result, error) {
+	order, err := l.prepare(ctx, s, l.autoOrder)
+	if err != nil {
+		return nil, err
+	}
+	store := newRowStore()
+	opts := l.insertOptions(l.newRegistry(store))
+
+	// Truncating commits implicitly on some databases, so there the
+	// tables are emptied before the transaction starts
+	if l.dialect.truncateCommits() {
+		if err := l.truncateFirst(ctx, s, order); err != nil {
+			return nil, err
+		}
+	}
+	conn, tx, inTx, err := l.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// fail rolls back everything loaded so far before aborting with err
+	fail := func(err error) (*Result, error) {
+		if tx != nil {
+			tx.Rollback()
+			fmt.Fprintln(l.log, "Transaction rolled back, no seed data was loaded.")
+		}
+		return nil, err
+	}
+
+	if !l.dialect.truncateCommits() {
+		if err := l.truncateTables(conn, s, order); err != nil {
+			return fail(err)
+		}
+	}
+
+	result := &Result{}
+	// written lists the columns each table was loaded with, whose
+	// sequences are advanced past the loaded values
+	written := map[string][]string{}
+	for _, table := range order {
+		t := s.tables[table]
+		fmt.Fprintf(l.log, "Processing table: %s (%d rows)\n", table, len(t.Rows))
+		start := time.Now()
+		var skipped error
+		if !inTx || !l.savepoints {
+			err = insertTable(conn, table, t, opts, store)
+		} else {
+			skipped, err = runSavepoint(conn, l.dialect, func() error {
+				return insertTable(conn, table, t, opts, store)
+			})
+		}
+		if err != nil {
+			return fail(err)
+		}
+		elapsed := time.Since(start)
+		switch {
+		case skipped != nil:
+			store.forget(table)
+			fmt.Fprintln(l.log, value.Mask(fmt.Sprintf("Warning: Skipping table '%s': %v", table, skipped)))
+		case !l.dryRun:
+			// The rate is left out when the clock did not advance
+			rate := ""
+			if seconds := elapsed.Seconds(); seconds > 0 {
+				rate = fmt.Sprintf(" (%.0f rows/s)", float64(len(t.Rows))/seconds)
+			}
+			fmt.Fprintf(l.log, "Loaded %d rows into %s in %s%s\n", len(t.Rows), table, elapsed.Round(time.Millisecond), rate)
+			written[table] = t.Columns
+		}
+		result.Tables = append(result.Tables, TableResult{
+			Name:     table,
+			Rows:     store.tableRows(table),
+			Skipped:  skipped,
+			Duration: elapsed,
+		})
+	}
+
+	sequences, err := advanceSequences(conn, l.dialect, order, written)
+	if err != nil {
+		return fail(err)
+	}
+	for _, seq := range sequences {
+		fmt.Fprintf(l.log, "Advanced sequence %s of %s.%s to %d\n", seq.Sequence, seq.Table, seq.Column, seq.Value)
+	}
+	result.Sequences = sequences
+
+	if tx != nil {
+		if err := tx.Commit(); err != nil {
+			return fail(fmt.Errorf("commit failed: %w", dbError(err)))
+		}
+	}
+	return result, nil
+}
+
+// insertTable inserts the rows of a table and records them in the store,
+// including any columns filled in by the database, so that later tables can
+// reference them with ref()
+func insertTable(db execer, table string, t *seedTable, opts insertOptions, store *rowStore) error {
+	if !opts.dryRun {
+		types, err := loadColumnTypes(db, opts.dialect, table)
+		if err != nil {
+			return t.errorAt(table, 0, 0, "", err)
+		}
+		t.Types = types
+	}
+
+	if useCopy(t, opts) {
+		if err := copyTable(db, table, t, opts, store); err != nil {
+			return err
+		}
+	} else {
+		offset := 0
+		for _, group := range groupRows(t.Rows, t.Columns, opts.dialect.supportsDefault()) {
+			batches := splitBatches(group.rows, len(group.columns), opts.batchSize, opts.dialect.maxParameters())
+			for _, batch := range batches {
+				if err := insertBatch(db, table, t, group.columns, batch, offset, opts, store); err != nil {
+					return err
+				}
+				offset += len(batch)
+			}
+		}
+	}
+
+	if opts.dryRun {
+		for _, tmpl := range t.Templates {
+			fmt.Fprintf(opts.out, "Generated %d rows of %s from the template at %s (output after the first row omitted)\n", tmpl.count, table, tmpl.position)
+		}
+	}
+	return nil
+}
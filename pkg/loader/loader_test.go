@@ -0,0 +1,243 @@
+package loader
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/tendant/dbload/pkg/value"
+)
+
+const loaderSchema = `
+CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT UNIQUE NOT NULL);
+CREATE TABLE orders (id INTEGER PRIMARY KEY, user_id INTEGER NOT NULL REFERENCES users(id));`
+
+const loaderSeed = `
+users:
+  - email: "john@example.com"
+orders:
+  - id: 1
+    user_id: "${ ref(users, 1, id) }"
+`
+
+func TestLoadFileInTransaction(t *testing.T) {
+	db := openTestDB(t, loaderSchema)
+	path := filepath.Join(writeSeedFiles(t, map[string]string{"seed.yaml": loaderSeed}), "seed.yaml")
+
+	tx, err := db.BeginTx(t.Context(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	result, err := LoadFile(t.Context(), tx, path, WithDriver("sqlite"))
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if len(result.Tables) != 2 || result.Tables[0].Name != "users" || result.Tables[1].Name != "orders" {
+		t.Fatalf("Tables = %+v, want users and orders", result.Tables)
+	}
+	// The result holds the id generated by the database
+	users := result.Table("users")
+	if len(users.Rows) != 1 || users.Rows[0]["id"] != int64(1) {
+		t.Errorf("users rows = %v, want the generated id", users.Rows)
+	}
+
+	// The rows are only visible in the transaction of the caller
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM orders WHERE user_id = 1").Scan(&count); err != nil || count != 1 {
+		t.Errorf("orders in transaction = %d (error %v), want 1", count, err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count); err != nil || count != 0 {
+		t.Errorf("users after rollback = %d (error %v), want 0", count, err)
+	}
+}
+
+func TestLoadFSAndBytes(t *testing.T) {
+	db := openTestDB(t, loaderSchema)
+	fsys := fstest.MapFS{
+		"seeds/users.yaml":  {Data: []byte("users:\n  - email: \"jane@example.com\"\n")},
+		"seeds/orders.yaml": {Data: []byte("include: users.yaml\norders:\n  - {id: 7, user_id: \"${ ref(users, 1, id) }\"}\n")},
+	}
+
+	l, err := New(WithDB(db), WithDriver("sqlite"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	result, err := l.LoadFS(t.Context(), fsys, "seeds/orders.yaml")
+	if err != nil {
+		t.Fatalf("LoadFS() error = %v", err)
+	}
+	if len(result.Tables) != 2 || result.Tables[0].Name != "users" {
+		t.Errorf("Tables = %+v, want the included users first", result.Tables)
+	}
+
+	// A dry run prints the statements without executing them
+	var out bytes.Buffer
+	l, err = New(WithDriver("sqlite"), WithDryRun(&out))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	seed := "users:\n  - {id: 1, email: \"john@example.com\"}\norders:\n  - {id: 1, user_id: \"${ ref(users, 1, id) }\"}\n"
+	if _, err := l.LoadBytes(context.Background(), []byte(seed)); err != nil {
+		t.Fatalf("LoadBytes() error = %v", err)
+	}
+	if !strings.Contains(out.String(), `SQL: INSERT INTO "orders"`) {
+		t.Errorf("dry run output = %q, want the INSERT statements", out.String())
+	}
+
+	// Errors report the position in the data
+	_, err = l.LoadBytes(context.Background(), []byte("users:\n  - {email: \"${ nope() }\"}\n"))
+	if err == nil || !strings.Contains(err.Error(), "input:2:") {
+		t.Errorf("LoadBytes() error = %v, want a position in input", err)
+	}
+}
+
+func TestLoaderFunctions(t *testing.T) {
+	t.Parallel()
+
+	shout := value.Function{
+		Params: []value.Param{{Name: "text", Type: value.String}},
+		Handler: func(_ *value.Context, args []interface{}) (interface{}, error) {
+			return strings.ToUpper(args[0].(string)), nil
+		},
+	}
+	registry := value.New()
+	var out bytes.Buffer
+	l, err := New(WithDriver("sqlite"), WithDryRun(&out), WithRegistry(registry), WithFunction("shout", shout))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	seed := "users:\n  - {id: 1, name: \"${ shout(john) }\"}\n"
+	if _, err := l.LoadBytes(t.Context(), []byte(seed)); err != nil {
+		t.Fatalf("LoadBytes() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "JOHN") {
+		t.Errorf("dry run output = %q, want the value of shout", out.String())
+	}
+
+	// The functions of the Loader are registered in a copy of its registry
+	for name, r := range map[string]*value.Registry{"registry": registry, "default": value.Default()} {
+		for _, fn := range []string{"shout", "ref"} {
+			if _, ok := r.Lookup(fn); ok {
+				t.Errorf("%s leaked into the %s registry", fn, name)
+			}
+		}
+	}
+	if _, ok := l.Functions().Lookup("shout"); !ok {
+		t.Error("Functions() has no shout function")
+	}
+}
+
+func TestLoadTruncate(t *testing.T) {
+	db := openTestDB(t, loaderSchema+`
+CREATE TABLE notes (id INTEGER PRIMARY KEY, text TEXT);
+INSERT INTO notes (text) VALUES ('kept');`)
+	seed := "users:\n  - {id: 1, email: \"john@example.com\"}\norders:\n  - {id: 1, user_id: 1}\nnotes:\n  - {id: 5, text: \"seeded\"}\n"
+	if _, err := db.Exec("INSERT INTO users (id, email) VALUES (7, 'old@example.com'); INSERT INTO orders (id, user_id) VALUES (9, 7)"); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	l, err := New(WithDB(db), WithDriver("sqlite"), WithLog(&out), WithTruncate("users", "orders"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, err := l.LoadBytes(t.Context(), []byte(seed)); err != nil {
+		t.Fatalf("LoadBytes() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "Truncating tables: users, orders") {
+		t.Errorf("log = %q, want the truncated tables", out.String())
+	}
+	// The listed tables hold the seed rows only, their AUTOINCREMENT
+	// counters restarted, and the other tables keep their rows
+	for query, want := range map[string]string{
+		"SELECT group_concat(email) FROM users":                              "john@example.com",
+		"SELECT group_concat(id) FROM orders":                                "1",
+		"SELECT group_concat(text, ',') FROM notes":                          "kept,seeded",
+		"SELECT group_concat(seq) FROM sqlite_sequence WHERE name = 'users'": "1",
+	} {
+		var got string
+		if err := db.QueryRow(query).Scan(&got); err != nil || got != want {
+			t.Errorf("%s = %q (error %v), want %q", query, got, err, want)
+		}
+	}
+
+	l, err = New(WithDB(db), WithDriver("sqlite"), WithTruncate("products"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, err := l.LoadBytes(t.Context(), []byte(seed)); err == nil || !strings.Contains(err.Error(), "cannot truncate products") {
+		t.Errorf("LoadBytes() error = %v, want a table that is not in the seed files", err)
+	}
+}
+
+func TestLoadPartialOrder(t *testing.T) {
+	// Tables left out of the order follow it in the order of the seed file
+	seed := "a:\n  - {id: 1}\nb:\n  - {id: 1}\nc:\n  - {id: 1}\nd:\n  - {id: 1}\ne:\n  - {id: 1}\n"
+	l, err := New(WithDryRun(nil), WithOrder("d", "b"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	for range 5 {
+		result, err := l.LoadBytes(t.Context(), []byte(seed))
+		if err != nil {
+			t.Fatalf("LoadBytes() error = %v", err)
+		}
+		var got []string
+		for _, table := range result.Tables {
+			got = append(got, table.Name)
+		}
+		if want := []string{"d", "b", "a", "c", "e"}; !slices.Equal(got, want) {
+			t.Fatalf("tables = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestLoadMasksSecrets(t *testing.T) {
+	// Errors returned by the Loader hide the values read with env(), even
+	// short ones
+	t.Setenv("DBLOAD_TEST_COST", "abc12")
+	seed := "users:\n  - {password: \"${ bcrypt(pw, env(DBLOAD_TEST_COST)) }\"}\n"
+	l, err := New(WithDryRun(nil))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	_, err = l.LoadBytes(t.Context(), []byte(seed))
+	if err == nil || strings.Contains(err.Error(), "abc12") || !strings.Contains(err.Error(), `got "***"`) {
+		t.Errorf("LoadBytes() error = %v, want the secret masked", err)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr string
+	}{
+		{name: "No database", opts: nil, wantErr: "a database is required"},
+		{name: "Unknown driver", opts: []Option{WithDriver("oracle"), WithDryRun(nil)}, wantErr: `unsupported driver "oracle"`},
+		{name: "Savepoints without transaction", opts: []Option{WithDryRun(nil), WithSavepoints(), WithoutTransaction()}, wantErr: "require a transaction"},
+		{name: "Unknown copy mode", opts: []Option{WithDryRun(nil), WithCopy("sometimes", 1)}, wantErr: `unknown copy mode "sometimes"`},
+		{name: "Unknown locale", opts: []Option{WithDryRun(nil), WithLocale("fr_FR")}, wantErr: `unsupported locale "fr_FR"`},
+		{name: "Truncate in a MySQL transaction", opts: []Option{WithDB(new(sql.Tx)), WithDriver("mysql"), WithTruncate()}, wantErr: "cannot run in the caller's transaction"},
+		{name: "Truncate on SQL Server", opts: []Option{WithDriver("sqlserver"), WithDryRun(nil), WithTruncate()}, wantErr: "truncating tables is not supported for sqlserver"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.opts...)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("New() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package loader
+
+import (
+	"fmt"
+	"strings"
+)
+
+// loadForeignKeys returns the tables referenced by each table in the database
+func loadForeignKeys(db execer, d dialect) (map[string][]string, error) {
+	query := d.foreignKeyQuery()
+	if query == "" {
+		return nil, fmt.Errorf("reading foreign keys is not supported for %s", d.name())
+	}
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("reading foreign keys failed: %w", err)
+	}
+	defer rows.Close()
+
+	deps := map[string][]string{}
+	for rows.Next() {
+		var table, referenced string
+		if err := rows.Scan(&table, &referenced); err != nil {
+			return nil, fmt.Errorf("reading foreign keys failed: %w", err)
+		}
+		deps[table] = append(deps[table], referenced)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading foreign keys failed: %w", err)
+	}
+	return deps, nil
+}
+
+// matchTableNames rewrites the table names of the foreign keys to the names
+// used in the seed file, so that for example "Users" in the schema matches
+// Users in the seed file
+func matchTableNames(tables []string, deps map[string][]string) map[string][]string {
+	names := make(map[string]string, len(tables))
+	for _, table := range tables {
+		names[canonicalName(table)] = table
+	}
+	rename := func(table string) string {
+		if name, ok := names[canonicalName(table)]; ok {
+			return name
+		}
+		return table
+	}
+
+	matched := make(map[string][]string, len(deps))
+	for table, referenced := range deps {
+		for _, ref := range referenced {
+			matched[rename(table)] = append(matched[rename(table)], rename(ref))
+		}
+	}
+	return matched
+}
+
+// sortTables orders tables so that every table comes after the tables it
+// references. Tables without a dependency between them keep their relative
+// order, and dependencies on tables that are not being loaded or on the
+// table itself are ignored. An error is returned when the foreign keys form
+// a cycle, since such tables can only be loaded with deferred constraints.
+func sortTables(tables []string, deps map[string][]string) ([]string, error) {
+	loading := make(map[string]bool, len(tables))
+	for _, table := range tables {
+		loading[table] = true
+	}
+
+	// pending returns the tables referenced by table that are not placed yet
+	placed := make(map[string]bool, len(tables))
+	pending := func(table string) []string {
+		var out []string
+		for _, dep := range deps[table] {
+			if dep != table && loading[dep] && !placed[dep] {
+				out = append(out, dep)
+			}
+		}
+		return out
+	}
+
+	sorted := make([]string, 0, len(tables))
+	for len(sorted) < len(tables) {
+		progress := false
+		for _, table := range tables {
+			if placed[table] || len(pending(table)) > 0 {
+				continue
+			}
+			sorted = append(sorted, table)
+			placed[table] = true
+			progress = true
+			// Restart from the beginning to keep the original order stable
+			break
+		}
+		if !progress {
+			return nil, fmt.Errorf("foreign key cycle between tables %s; these tables require deferred constraints to load",
+				strings.Join(findCycle(tables, placed, pending), " -> "))
+		}
+	}
+	return sorted, nil
+}
+
+// findCycle follows unplaced dependencies from the first unplaced table until
+// a table repeats and returns the tables that form the cycle
+func findCycle(tables []string, placed map[string]bool, pending func(string) []string) []string {
+	var start string
+	for _, table := range tables {
+		if !placed[table] {
+			start = table
+			break
+		}
+	}
+
+	seen := map[string]int{}
+	var path []string
+	for table := start; ; table = pending(table)[0] {
+		if i, ok := seen[table]; ok {
+			return append(path[i:], table)
+		}
+		seen[table] = len(path)
+		path = append(path, table)
+	}
+}
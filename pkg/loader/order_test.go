@@ -0,0 +1,76 @@
+package loader
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSortTables(t *testing.T) {
+	tests := []struct {
+		name    string
+		tables  []string
+		deps    map[string][]string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:   "No dependencies keeps order",
+			tables: []string{"inventory", "users", "products"},
+			deps:   map[string][]string{},
+			want:   []string{"inventory", "users", "products"},
+		},
+		{
+			name:   "Referenced tables come first",
+			tables: []string{"inventory", "users", "products"},
+			deps:   map[string][]string{"inventory": {"products"}},
+			want:   []string{"users", "products", "inventory"},
+		},
+		{
+			name:   "Chained dependencies",
+			tables: []string{"order_items", "orders", "users", "products"},
+			deps: map[string][]string{
+				"order_items": {"orders", "products"},
+				"orders":      {"users"},
+			},
+			want: []string{"users", "orders", "products", "order_items"},
+		},
+		{
+			name:   "Self references and tables not loaded are ignored",
+			tables: []string{"employees", "audit"},
+			deps: map[string][]string{
+				"employees": {"employees"},
+				"audit":     {"accounts"},
+			},
+			want: []string{"employees", "audit"},
+		},
+		{
+			name:   "Cycle is reported",
+			tables: []string{"users", "teams", "products"},
+			deps: map[string][]string{
+				"users": {"teams"},
+				"teams": {"users"},
+			},
+			wantErr: "users -> teams -> users",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sortTables(tt.tables, tt.deps)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("sortTables() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("sortTables() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sortTables() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
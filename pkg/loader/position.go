@@ -0,0 +1,180 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/tendant/dbload/pkg/value"
+	"gopkg.in/yaml.v3"
+)
+
+// position is a line and column in a seed file
+type position struct {
+	file   string
+	line   int
+	column int
+}
+
+func (p position) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.file, p.line, p.column)
+}
+
+// rowPosition locates a row of a table and the values of its cells
+type rowPosition struct {
+	position
+	cells map[string]position
+}
+
+// nodePosition returns the position of a YAML node
+func nodePosition(node *yaml.Node) position {
+	return position{line: node.Line, column: node.Column}
+}
+
+// rowPositions records the position of every row in a sequence of rows and
+// of the value of each of its cells. Rows written as an alias only record
+// the position of the alias.
+func rowPositions(rowsNode *yaml.Node) []rowPosition {
+	if rowsNode == nil || rowsNode.Kind != yaml.SequenceNode {
+		return nil
+	}
+	positions := make([]rowPosition, len(rowsNode.Content))
+	for i, rowNode := range rowsNode.Content {
+		positions[i] = rowPosition{position: nodePosition(rowNode), cells: map[string]position{}}
+		cells := cellsNode(rowNode)
+		if cells.Kind != yaml.MappingNode {
+			continue
+		}
+		for j := 0; j+1 < len(cells.Content); j += 2 {
+			if key := cells.Content[j].Value; key != "<<" {
+				positions[i].cells[key] = nodePosition(cells.Content[j+1])
+			}
+		}
+	}
+	return positions
+}
+
+// setFile records the seed file a table was read from in its positions
+func (t *seedTable) setFile(path string) {
+	t.Position.file = path
+	for i := range t.Positions {
+		t.Positions[i].file = path
+		for column, p := range t.Positions[i].cells {
+			p.file = path
+			t.Positions[i].cells[column] = p
+		}
+	}
+	for i := range t.Templates {
+		t.Templates[i].file = path
+	}
+}
+
+// seedError is an error in a table, a run of rows or a single cell of the
+// seed file, reported as seed.yaml:42:15 users[3].email: ...
+type seedError struct {
+	pos    position
+	table  string
+	row    int
+	count  int
+	column string
+	err    error
+}
+
+func (e *seedError) Error() string {
+	var b strings.Builder
+	if e.pos.file != "" && e.pos.line > 0 {
+		b.WriteString(e.pos.String() + " ")
+	}
+	b.WriteString(e.table)
+	switch {
+	case e.count > 1:
+		fmt.Fprintf(&b, "[%d-%d]", e.row, e.row+e.count-1)
+	case e.row > 0:
+		fmt.Fprintf(&b, "[%d]", e.row)
+	}
+	if e.column != "" {
+		b.WriteString("." + e.column)
+	}
+	b.WriteString(": ")
+	b.WriteString(e.err.Error())
+	return b.String()
+}
+
+func (e *seedError) Unwrap() error {
+	return e.err
+}
+
+// errorAt attaches a location in the seed file to an error. row is the
+// 1-based position of the first of count rows the error concerns, or 0 for
+// the whole table, and column names the cell when there is a single row.
+// Cells that are not written in the seed file are reported at their row.
+func (t *seedTable) errorAt(table string, row, count int, column string, err error) error {
+	e := &seedError{pos: t.Position, table: table, row: row, count: count, column: column, err: err}
+	if row > 0 && row <= len(t.Positions) {
+		rowPos := t.Positions[row-1]
+		e.pos = rowPos.position
+		if p, ok := rowPos.cells[column]; ok && count <= 1 {
+			e.pos = p
+		}
+	}
+	return e
+}
+
+// dbRowError reports a failed database statement for a run of rows, at the
+// cell of the column named by the database when there is a single row
+func (t *seedTable) dbRowError(table string, row, count int, action string, err error) error {
+	column := ""
+	var pqErr *pq.Error
+	if count == 1 && errors.As(err, &pqErr) {
+		column = pqErr.Column
+	}
+	return t.errorAt(table, row, count, column, fmt.Errorf("%s failed: %w", action, dbError(err)))
+}
+
+// dbError adds the detail, hint and constraint name of a Postgres error to
+// its message, one per line
+func dbError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+	var lines []string
+	for _, field := range []struct{ name, value string }{
+		{"detail", pqErr.Detail},
+		{"hint", pqErr.Hint},
+		{"constraint", pqErr.Constraint},
+		{"where", pqErr.Where},
+	} {
+		if field.value != "" {
+			lines = append(lines, fmt.Sprintf("\n  %s: %s", field.name, field.value))
+		}
+	}
+	if len(lines) == 0 {
+		return err
+	}
+	return fmt.Errorf("%w%s", err, strings.Join(lines, ""))
+}
+
+// maskedError hides the values read with env() and file() in the message of
+// an error, which errors.Is and errors.As still see through
+type maskedError struct {
+	err error
+}
+
+func (e *maskedError) Error() string {
+	return value.Mask(e.err.Error())
+}
+
+func (e *maskedError) Unwrap() error {
+	return e.err
+}
+
+// masked masks the error of a load or a clean before it is returned to the
+// caller of the Loader
+func masked(result *Result, err error) (*Result, error) {
+	if err != nil {
+		return result, &maskedError{err: err}
+	}
+	return result, nil
+}
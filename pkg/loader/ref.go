@@ -0,0 +1,136 @@
+package loader
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/tendant/dbload/pkg/value"
+)
+
+// refKeyColumn is the column used to look up rows referenced with ref()
+const refKeyColumn = "id"
+
+// rowStore records the rows inserted into each table so that later tables
+// can reference their values with the ref function
+type rowStore struct {
+	mu   sync.RWMutex
+	rows map[string][]map[string]interface{}
+}
+
+// newRowStore creates an empty row store
+func newRowStore() *rowStore {
+	return &rowStore{rows: map[string][]map[string]interface{}{}}
+}
+
+// add records a row inserted into the given table
+func (s *rowStore) add(table string, row map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rows[table] = append(s.rows[table], row)
+}
+
+// forget removes the rows recorded for a table, for example when its
+// inserts were rolled back
+func (s *rowStore) forget(table string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.rows, table)
+}
+
+// tableRows returns the rows recorded for a table
+func (s *rowStore) tableRows(table string) []map[string]interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.rows[table])
+}
+
+// lookup finds the row of a table whose id column matches key. When the
+// rows of the table have no id column, key is treated as the 1-based
+// position of the row in the table instead.
+func (s *rowStore) lookup(table, key string) (map[string]interface{}, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, ok := s.rows[table]
+	if !ok {
+		return nil, fmt.Errorf("no rows recorded for table %s (is it loaded before the referencing table?)", table)
+	}
+
+	hasID := false
+	for _, row := range rows {
+		id, ok := row[refKeyColumn]
+		if !ok || id == nil {
+			continue
+		}
+		hasID = true
+		if fmt.Sprintf("%v", id) == key {
+			return row, nil
+		}
+	}
+
+	if pos, err := strconv.Atoi(key); err == nil && !hasID && pos >= 1 && pos <= len(rows) {
+		return rows[pos-1], nil
+	}
+
+	return nil, fmt.Errorf("no row with %s %s in table %s", refKeyColumn, key, table)
+}
+
+// refFunction returns the ref(table, key, column) function, which returns
+// the value of column from a previously inserted row of table
+func (s *rowStore) refFunction() value.Function {
+	return value.Function{
+		Params: []value.Param{
+			{Name: "table", Type: value.String},
+			{Name: "key", Type: value.String},
+			{Name: "column", Type: value.String},
+		},
+		Handler: func(_ *value.Context, args []interface{}) (interface{}, error) {
+			return s.ref(args[0].(string), args[1].(string), args[2].(string))
+		},
+	}
+}
+
+// ref returns the value of column from the row of table matching key
+func (s *rowStore) ref(table, key, column string) (interface{}, error) {
+	row, err := s.lookup(table, key)
+	if err != nil {
+		return nil, err
+	}
+
+	v, ok := row[column]
+	if !ok {
+		return nil, fmt.Errorf("row %s of table %s has no column %s", key, table, column)
+	}
+	return v, nil
+}
+
+// scanRow reads the current row of a result set into a map keyed by column name
+func scanRow(rows *sql.Rows) (map[string]interface{}, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		return nil, err
+	}
+
+	row := make(map[string]interface{}, len(columns))
+	for i, column := range columns {
+		// Text columns are returned as raw bytes by the driver
+		if b, ok := values[i].([]byte); ok {
+			row[column] = string(b)
+		} else {
+			row[column] = values[i]
+		}
+	}
+	return row, nil
+}
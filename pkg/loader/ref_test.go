@@ -0,0 +1,45 @@
+package loader
+
+import (
+	"testing"
+
+	"github.com/tendant/dbload/pkg/value"
+)
+
+func TestRefFunction(t *testing.T) {
+	store := newRowStore()
+	store.add("users", map[string]interface{}{"id": 1, "email": "john@example.com"})
+	store.add("users", map[string]interface{}{"id": 7, "email": "jane@example.com"})
+	store.add("orders", map[string]interface{}{"total": 10})
+	r := value.New()
+	r.Register("ref", store.refFunction())
+	ref, _ := r.GetFunction("ref")
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    interface{}
+		wantErr bool
+	}{
+		{name: "Lookup by id", args: []string{"users", "7", "email"}, want: "jane@example.com"},
+		{name: "Lookup by id returns typed value", args: []string{"users", "1", "id"}, want: 1},
+		{name: "Lookup by position without id column", args: []string{"orders", "1", "total"}, want: 10},
+		{name: "Unknown table", args: []string{"products", "1", "id"}, wantErr: true},
+		{name: "Unknown key", args: []string{"users", "42", "email"}, wantErr: true},
+		{name: "Unknown column", args: []string{"users", "1", "name"}, wantErr: true},
+		{name: "Wrong number of arguments", args: []string{"users", "1"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ref(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ref() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ref() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,414 @@
+package loader
+
+import (
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// includeKey is the top-level key listing the seed files a file includes
+const includeKey = "include"
+
+// Strategies for merging a table with the same table from earlier seed files
+const (
+	// mergeAppend adds the rows after the earlier rows
+	mergeAppend = "append"
+	// mergeReplace drops the earlier rows
+	mergeReplace = "replace"
+	// mergeOverride updates the earlier rows with the same merge_key
+	// values and adds the other rows
+	mergeOverride = "override"
+)
+
+// seedLoader loads seed files with the files they include and merges their
+// tables
+type seedLoader struct {
+	fsys   seedFS
+	tables map[string]*seedTable
+	// order lists the tables in the order they first appear
+	order []string
+	// loaded holds the absolute paths of the files loaded so far, which
+	// are not loaded again when included a second time
+	loaded map[string]bool
+	// stack holds the files being loaded, to detect include cycles
+	stack []string
+}
+
+// newSeedLoader returns a loader reading seed files from fsys
+func newSeedLoader(fsys seedFS) *seedLoader {
+	return &seedLoader{fsys: fsys, tables: map[string]*seedTable{}, loaded: map[string]bool{}}
+}
+
+// loadYAML loads the seed files matching each path, which may be a file, a
+// directory or a glob, in order. It returns the merged tables and the order
+// in which the tables first appear.
+func loadYAML(paths ...string) (map[string]*seedTable, []string, error) {
+	l := newSeedLoader(seedFS{})
+	if err := l.loadPaths(paths...); err != nil {
+		return nil, nil, err
+	}
+	return l.tables, l.order, nil
+}
+
+// loadPaths loads the seed files matching each path in order
+func (l *seedLoader) loadPaths(paths ...string) error {
+	for _, pattern := range paths {
+		files, err := l.fsys.expand(pattern)
+		if err != nil {
+			return err
+		}
+		for _, path := range files {
+			if err := l.load(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// seedFS is the file system seed files are read from: the file system of
+// the operating system, or an fs.FS when fsys is set
+type seedFS struct {
+	fsys fs.FS
+}
+
+func (s seedFS) readFile(name string) ([]byte, error) {
+	if s.fsys == nil {
+		return os.ReadFile(name)
+	}
+	return fs.ReadFile(s.fsys, name)
+}
+
+func (s seedFS) stat(name string) (fs.FileInfo, error) {
+	if s.fsys == nil {
+		return os.Stat(name)
+	}
+	return fs.Stat(s.fsys, name)
+}
+
+func (s seedFS) readDir(name string) ([]fs.DirEntry, error) {
+	if s.fsys == nil {
+		return os.ReadDir(name)
+	}
+	return fs.ReadDir(s.fsys, name)
+}
+
+func (s seedFS) glob(pattern string) ([]string, error) {
+	if s.fsys == nil {
+		return filepath.Glob(pattern)
+	}
+	return fs.Glob(s.fsys, pattern)
+}
+
+func (s seedFS) join(dir, name string) string {
+	if s.fsys == nil {
+		return filepath.Join(dir, name)
+	}
+	return path.Join(dir, name)
+}
+
+// resolve returns the path of a file included by the file at from
+func (s seedFS) resolve(from, name string) string {
+	if s.fsys == nil {
+		if filepath.IsAbs(name) {
+			return name
+		}
+		return filepath.Join(filepath.Dir(from), name)
+	}
+	return path.Join(path.Dir(from), name)
+}
+
+// abs returns the path identifying a file, to detect files loaded twice
+func (s seedFS) abs(name string) (string, error) {
+	if s.fsys == nil {
+		return filepath.Abs(name)
+	}
+	return path.Clean(name), nil
+}
+
+// expand returns the seed files a path refers to: the file itself, the
+// .yaml and .yml files of a directory, or the files matching a glob
+func (s seedFS) expand(name string) ([]string, error) {
+	if strings.ContainsAny(name, "*?[") {
+		files, err := s.glob(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", name, err)
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no seed files match %s", name)
+		}
+		sort.Strings(files)
+		return files, nil
+	}
+
+	info, err := s.stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{name}, nil
+	}
+	entries, err := s.readDir(name)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if ext := path.Ext(entry.Name()); !entry.IsDir() && (ext == ".yaml" || ext == ".yml") {
+			files = append(files, s.join(name, entry.Name()))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no seed files in directory %s", name)
+	}
+	return files, nil
+}
+
+// load loads a seed file. The files it includes are loaded first, so that
+// the tables of the including file are merged into theirs.
+func (l *seedLoader) load(path string) error {
+	abs, err := l.fsys.abs(path)
+	if err != nil {
+		return err
+	}
+	for i, p := range l.stack {
+		if p == abs {
+			cycle := append(append([]string{}, l.stack[i:]...), abs)
+			return fmt.Errorf("include cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	if l.loaded[abs] {
+		return nil
+	}
+	l.stack = append(l.stack, abs)
+	defer func() { l.stack = l.stack[:len(l.stack)-1] }()
+
+	data, err := l.fsys.readFile(path)
+	if err != nil {
+		return err
+	}
+	if err := l.parse(path, data); err != nil {
+		return err
+	}
+	l.loaded[abs] = true
+	return nil
+}
+
+// parse reads the tables of a seed file and merges them into the tables
+// read before
+func (l *seedLoader) parse(path string, data []byte) error {
+	// Unmarshal into a yaml.Node to preserve the order of the tables
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return fileError(path, err)
+	}
+	if len(root.Content) == 0 {
+		return nil
+	}
+	mapping := root.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		return fileError(path, nodeError(mapping, fmt.Errorf("a seed file must be a mapping of table names to rows")))
+	}
+
+	if includeNode := mappingValue(mapping, includeKey); includeNode != nil {
+		if err := l.include(path, includeNode); err != nil {
+			return err
+		}
+	}
+
+	seen := map[string]bool{}
+	// In a mapping node, keys are at even indices (0, 2, 4, ...)
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		keyNode, valueNode := mapping.Content[i], mapping.Content[i+1]
+		tableName := keyNode.Value
+		if tableName == includeKey {
+			continue
+		}
+		if err := validateTableName(tableName); err != nil {
+			return fileError(path, nodeError(keyNode, fmt.Errorf("invalid table name: %w", err)))
+		}
+		if seen[tableName] {
+			return fileError(path, nodeError(keyNode, fmt.Errorf("table %s is defined twice", tableName)))
+		}
+		seen[tableName] = true
+
+		// A table without rows decodes to an empty table
+		t := &seedTable{}
+		if err := valueNode.Decode(t); err != nil {
+			return fileError(path, err)
+		}
+		t.Position = nodePosition(keyNode)
+		t.setFile(path)
+
+		existing, ok := l.tables[tableName]
+		if !ok {
+			if err := validateMerge(tableName, t); err != nil {
+				return err
+			}
+			l.tables[tableName] = t
+			l.order = append(l.order, tableName)
+			continue
+		}
+		if err := mergeTables(tableName, existing, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// include loads the files listed under include:, a path or a list of paths
+// relative to the including file
+func (l *seedLoader) include(path string, node *yaml.Node) error {
+	items := []*yaml.Node{node}
+	if node.Kind == yaml.SequenceNode {
+		items = node.Content
+	}
+	for _, item := range items {
+		if item.Kind != yaml.ScalarNode || item.Value == "" {
+			return fileError(path, nodeError(item, fmt.Errorf("%s must be a path or a list of paths", includeKey)))
+		}
+		files, err := l.fsys.expand(l.fsys.resolve(path, item.Value))
+		if err != nil {
+			return fileError(path, nodeError(item, fmt.Errorf("cannot include %s: %w", item.Value, err)))
+		}
+		for _, file := range files {
+			if err := l.load(file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateMerge checks the merge strategy of a table
+func validateMerge(table string, t *seedTable) error {
+	switch t.Merge {
+	case "", mergeAppend, mergeReplace, mergeOverride:
+		return nil
+	default:
+		return t.errorAt(table, 0, 0, "", fmt.Errorf("unknown merge strategy %q (use %s, %s or %s)", t.Merge, mergeAppend, mergeReplace, mergeOverride))
+	}
+}
+
+// mergeTables merges a table from a later seed file into the same table
+// from the earlier files, according to the merge strategy of the later
+// table. Options set by the later table replace the earlier ones.
+func mergeTables(table string, existing, t *seedTable) error {
+	if err := validateMerge(table, t); err != nil {
+		return err
+	}
+	if t.OnConflict != "" {
+		existing.OnConflict = t.OnConflict
+	}
+	if len(t.ConflictKey) > 0 {
+		existing.ConflictKey = t.ConflictKey
+	}
+	if t.Missing != "" {
+		existing.Missing = t.Missing
+	}
+	if len(t.NaturalKey) > 0 {
+		existing.NaturalKey = t.NaturalKey
+	}
+
+	switch t.Merge {
+	case mergeReplace:
+		existing.Rows, existing.Positions, existing.Templates = t.Rows, t.Positions, t.Templates
+		existing.Columns = t.Columns
+		return nil
+	case mergeOverride:
+		key := t.MergeKey
+		if len(key) == 0 {
+			key = []string{refKeyColumn}
+		}
+		for i, row := range t.Rows {
+			match, err := findRow(existing.Rows, row, key)
+			if err != nil {
+				return t.errorAt(table, i+1, 1, "", fmt.Errorf("cannot override: %w", err))
+			}
+			if match < 0 {
+				existing.Rows = append(existing.Rows, row)
+				existing.Positions = append(existing.Positions, t.Positions[i])
+				continue
+			}
+			if existing.Rows[match] == nil {
+				existing.Rows[match] = map[string]interface{}{}
+			}
+			// The rows generated from a template share the positions of
+			// their cells, so the positions are copied before changing them
+			existing.Positions[match].cells = maps.Clone(existing.Positions[match].cells)
+			if existing.Positions[match].cells == nil {
+				existing.Positions[match].cells = map[string]position{}
+			}
+			for column, v := range row {
+				existing.Rows[match][column] = v
+				existing.Positions[match].cells[column] = t.Positions[i].cells[column]
+			}
+		}
+	default:
+		for _, tmpl := range t.Templates {
+			tmpl.start += len(existing.Rows)
+			existing.Templates = append(existing.Templates, tmpl)
+		}
+		existing.Rows = append(existing.Rows, t.Rows...)
+		existing.Positions = append(existing.Positions, t.Positions...)
+	}
+
+	for _, column := range t.Columns {
+		if !slices.Contains(existing.Columns, column) {
+			existing.Columns = append(existing.Columns, column)
+		}
+	}
+	return nil
+}
+
+// findRow returns the index of the row whose key columns have the same
+// values as those of row, or -1 if there is none. Rows are matched before
+// their values are evaluated, so key columns written as expressions are
+// rejected rather than never matching.
+func findRow(rows []map[string]interface{}, row map[string]interface{}, key []string) (int, error) {
+	for _, column := range key {
+		v, ok := row[column]
+		if !ok {
+			return -1, fmt.Errorf("row has no value for merge_key column %s", column)
+		}
+		if isExpression(v) {
+			return -1, fmt.Errorf("merge_key column %s cannot be an expression", column)
+		}
+	}
+	for i, candidate := range rows {
+		matches := true
+		for _, column := range key {
+			v, ok := candidate[column]
+			if ok && isExpression(v) {
+				return -1, fmt.Errorf("merge_key column %s of row %d of the earlier files cannot be an expression", column, i+1)
+			}
+			if !ok || fmt.Sprint(v) != fmt.Sprint(row[column]) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+
+// isExpression reports whether a cell is evaluated when it is loaded
+func isExpression(v interface{}) bool {
+	switch v := v.(type) {
+	case expression:
+		return true
+	case string:
+		return strings.Contains(v, "${")
+	}
+	return false
+}
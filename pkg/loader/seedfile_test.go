@@ -0,0 +1,170 @@
+package loader
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeSeedFiles writes seed files into a temporary directory and returns it
+func writeSeedFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadYAMLMerge(t *testing.T) {
+	dir := writeSeedFiles(t, map[string]string{
+		"base/users.yaml": "users:\n  - {id: 1, name: Alice}\n  - {id: 2, name: Bob}\nroles:\n  - {id: 1}\n",
+		"base/posts.yml":  "posts:\n  - {id: 1, user_id: 1}\n",
+		"base/notes.txt":  "not a seed file",
+		"dev.yaml": `include: base
+users:
+  merge: override
+  rows:
+    - {id: 2, name: Bobby, admin: true}
+    - {id: 3, name: Carol}
+posts:
+  - {id: 2, user_id: 3}
+`,
+		"test.yaml": "roles:\n  merge: replace\n  rows:\n    - {id: 9}\n",
+	})
+
+	tables, order, err := loadYAML(filepath.Join(dir, "dev.yaml"), filepath.Join(dir, "test.yaml"))
+	if err != nil {
+		t.Fatalf("loadYAML() error = %v", err)
+	}
+
+	// The included directory is loaded in file name order
+	if want := []string{"posts", "users", "roles"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+	wantUsers := []map[string]interface{}{
+		{"id": 1, "name": "Alice"},
+		{"id": 2, "name": "Bobby", "admin": true},
+		{"id": 3, "name": "Carol"},
+	}
+	if !reflect.DeepEqual(tables["users"].Rows, wantUsers) {
+		t.Errorf("users = %v, want %v", tables["users"].Rows, wantUsers)
+	}
+	if want := []string{"id", "name", "admin"}; !reflect.DeepEqual(tables["users"].Columns, want) {
+		t.Errorf("users columns = %v, want %v", tables["users"].Columns, want)
+	}
+	if got := len(tables["posts"].Rows); got != 2 {
+		t.Errorf("posts has %d rows, want 2", got)
+	}
+	if want := []map[string]interface{}{{"id": 9}}; !reflect.DeepEqual(tables["roles"].Rows, want) {
+		t.Errorf("roles = %v, want %v", tables["roles"].Rows, want)
+	}
+
+	// Merged cells keep the position of the file that set them
+	pos := tables["users"].Positions[1]
+	if !strings.HasSuffix(pos.cells["name"].file, "dev.yaml") || !strings.HasSuffix(pos.cells["id"].file, "dev.yaml") || !strings.HasSuffix(pos.file, "users.yaml") {
+		t.Errorf("positions of users[2] = %v", pos)
+	}
+
+	// A glob matches the same files
+	tables, _, err = loadYAML(filepath.Join(dir, "base", "*.y*ml"))
+	if err != nil {
+		t.Fatalf("loadYAML() error = %v", err)
+	}
+	if len(tables) != 3 {
+		t.Errorf("glob loaded %d tables, want 3", len(tables))
+	}
+
+	// Overriding a row generated from a template leaves the positions of
+	// the other rows of the template unchanged
+	dir = writeSeedFiles(t, map[string]string{
+		"base.yaml": "users:\n  - _repeat: 3\n    _template: {id: \"{{i}}\", name: \"user{{i}}\"}\n",
+		"dev.yaml":  "users:\n  merge: override\n  rows:\n    - {id: \"2\", name: Bobby}\n",
+	})
+	tables, _, err = loadYAML(filepath.Join(dir, "base.yaml"), filepath.Join(dir, "dev.yaml"))
+	if err != nil {
+		t.Fatalf("loadYAML() error = %v", err)
+	}
+	for i, want := range []string{"base.yaml", "dev.yaml", "base.yaml"} {
+		if got := tables["users"].Positions[i].cells["name"].file; !strings.HasSuffix(got, want) {
+			t.Errorf("position of users[%d].name = %s, want %s", i+1, got, want)
+		}
+	}
+}
+
+func TestLoadYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		load    string
+		wantErr string
+	}{
+		{
+			name:    "Include cycle",
+			files:   map[string]string{"a.yaml": "include: b.yaml\n", "b.yaml": "include: [sub/c.yaml]\n", "sub/c.yaml": "include: ../a.yaml\n"},
+			load:    "a.yaml",
+			wantErr: "include cycle: DIR/a.yaml -> DIR/b.yaml -> DIR/sub/c.yaml -> DIR/a.yaml",
+		},
+		{
+			name:    "Missing include",
+			files:   map[string]string{"a.yaml": "include: missing.yaml\n"},
+			load:    "a.yaml",
+			wantErr: "a.yaml:1:10: cannot include missing.yaml",
+		},
+		{
+			name:    "Include is not a path",
+			files:   map[string]string{"a.yaml": "include: {a: 1}\n"},
+			load:    "a.yaml",
+			wantErr: "a.yaml:1:10: include must be a path or a list of paths",
+		},
+		{
+			name:    "Unknown merge strategy",
+			files:   map[string]string{"a.yaml": "users: [{id: 1}]\n", "b.yaml": "users:\n  merge: combine\n  rows: [{id: 1}]\n"},
+			load:    "*.yaml",
+			wantErr: `b.yaml:1:1 users: unknown merge strategy "combine"`,
+		},
+		{
+			name:    "Override row without key",
+			files:   map[string]string{"a.yaml": "users: [{id: 1}]\n", "b.yaml": "users:\n  merge: override\n  merge_key: [email]\n  rows:\n    - {id: 1}\n"},
+			load:    "*.yaml",
+			wantErr: "b.yaml:5:7 users[1]: cannot override: row has no value for merge_key column email",
+		},
+		{
+			name:    "Override key written as an expression",
+			files:   map[string]string{"a.yaml": "users: [{id: 1}]\n", "b.yaml": "users:\n  merge: override\n  rows:\n    - {id: \"${ fake.int(1, 1) }\"}\n"},
+			load:    "*.yaml",
+			wantErr: "b.yaml:4:7 users[1]: cannot override: merge_key column id cannot be an expression",
+		},
+		{
+			name:    "Overridden key written as an expression",
+			files:   map[string]string{"a.yaml": "users: [{id: !expr \"fake.int(1, 1)\"}]\n", "b.yaml": "users:\n  merge: override\n  rows:\n    - {id: 1}\n"},
+			load:    "*.yaml",
+			wantErr: "cannot override: merge_key column id of row 1 of the earlier files cannot be an expression",
+		},
+		{
+			name:    "No matching files",
+			files:   map[string]string{"a.yaml": "users: []\n"},
+			load:    "*.yml",
+			wantErr: "no seed files match",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeSeedFiles(t, tt.files)
+			_, _, err := loadYAML(filepath.Join(dir, tt.load))
+			want := strings.ReplaceAll(tt.wantErr, "DIR", dir)
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("loadYAML() error = %v, want %q", err, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package loader
+
+import (
+	"fmt"
+	"slices"
+)
+
+// SequenceResult describes a sequence advanced past the values loaded into
+// its column
+type SequenceResult struct {
+	Table    string
+	Column   string
+	Sequence string
+	// Value is the new value of the sequence, the largest value of the
+	// column; the sequence returns the values after it next
+	Value int64
+}
+
+// sequenceColumn is a column backed by a sequence
+type sequenceColumn struct {
+	column   string
+	sequence string
+}
+
+// loadSequences reads the columns of a table backed by a sequence from the
+// catalog. It returns nil when the dialect keeps its counters itself.
+func loadSequences(db execer, d dialect, table string) ([]sequenceColumn, error) {
+	query, args := d.sequenceQuery(table)
+	if query == "" {
+		return nil, nil
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("reading sequences failed: %w", dbError(err))
+	}
+	defer rows.Close()
+
+	var sequences []sequenceColumn
+	for rows.Next() {
+		var s sequenceColumn
+		if err := rows.Scan(&s.column, &s.sequence); err != nil {
+			return nil, fmt.Errorf("reading sequences failed: %w", dbError(err))
+		}
+		sequences = append(sequences, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading sequences failed: %w", dbError(err))
+	}
+	return sequences, nil
+}
+
+// advanceSequences moves the sequence of every column the tables were
+// loaded with explicit values into past the largest value of the column,
+// so that the ids the database generates next do not collide with the
+// loaded ones. It returns the sequences it moved, in the order of tables.
+func advanceSequences(db execer, d dialect, tables []string, written map[string][]string) ([]SequenceResult, error) {
+	var results []SequenceResult
+	for _, table := range tables {
+		if len(written[table]) == 0 {
+			continue
+		}
+		sequences, err := loadSequences(db, d, table)
+		if err != nil {
+			return nil, fmt.Errorf("table %s: %w", table, err)
+		}
+		for _, s := range sequences {
+			if !slices.Contains(written[table], s.column) {
+				continue
+			}
+			value, moved, err := advanceSequence(db, d, table, s)
+			if err != nil {
+				return nil, fmt.Errorf("advancing sequence %s failed: %w", s.sequence, dbError(err))
+			}
+			if moved {
+				results = append(results, SequenceResult{Table: table, Column: s.column, Sequence: s.sequence, Value: value})
+			}
+		}
+	}
+	return results, nil
+}
+
+// advanceSequence moves the sequence of a column past its largest value
+// when the sequence is behind, and returns its new value
+func advanceSequence(db execer, d dialect, table string, s sequenceColumn) (int64, bool, error) {
+	rows, err := db.Query(d.advanceSequence(table, s.column), s.sequence)
+	if err != nil {
+		return 0, false, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return 0, false, rows.Err()
+	}
+	var value int64
+	if err := rows.Scan(&value); err != nil {
+		return 0, false, err
+	}
+	return value, true, rows.Err()
+}
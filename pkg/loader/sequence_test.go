@@ -0,0 +1,56 @@
+package loader
+
+import (
+	"fmt"
+	"testing"
+)
+
+// sequenceDialect emulates sequences on SQLite with a table holding the
+// last value of each sequence
+type sequenceDialect struct {
+	sqliteDialect
+}
+
+func (sequenceDialect) sequenceQuery(table string) (string, []interface{}) {
+	return `SELECT "column", name FROM sequences WHERE "table" = ? ORDER BY name`, []interface{}{table}
+}
+
+func (d sequenceDialect) advanceSequence(table, column string) string {
+	largest := fmt.Sprintf("(SELECT MAX(%s) FROM %s)", quoteName(d, column), quoteName(d, table))
+	return fmt.Sprintf("UPDATE sequences SET value = %s WHERE name = ? AND value < %[1]s RETURNING value", largest)
+}
+
+func TestAdvanceSequences(t *testing.T) {
+	db := openTestDB(t, `
+CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT, code INTEGER);
+CREATE TABLE orders (id INTEGER PRIMARY KEY);
+CREATE TABLE sequences (name TEXT PRIMARY KEY, "table" TEXT, "column" TEXT, value INTEGER);
+INSERT INTO sequences VALUES ('users_id_seq', 'users', 'id', 0), ('users_code_seq', 'users', 'code', 0), ('orders_id_seq', 'orders', 'id', 10);`)
+
+	l, err := New(WithDB(db), WithDriver("sqlite"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	l.dialect = sequenceDialect{}
+	seed := "users:\n  - {id: 1, email: \"john@example.com\"}\n  - {id: 3, email: \"jane@example.com\"}\norders:\n  - {id: 2}\n"
+	result, err := l.LoadBytes(t.Context(), []byte(seed))
+	if err != nil {
+		t.Fatalf("LoadBytes() error = %v", err)
+	}
+
+	// Only the sequence behind the explicit ids moved: code was not
+	// written, and the orders sequence is ahead of the loaded id
+	want := []SequenceResult{{Table: "users", Column: "id", Sequence: "users_id_seq", Value: 3}}
+	if fmt.Sprint(result.Sequences) != fmt.Sprint(want) {
+		t.Errorf("Sequences = %+v, want %+v", result.Sequences, want)
+	}
+
+	// A second load finds the sequence in step
+	result, err = l.LoadBytes(t.Context(), []byte(seed))
+	if err != nil {
+		t.Fatalf("LoadBytes() again error = %v", err)
+	}
+	if len(result.Sequences) != 0 {
+		t.Errorf("Sequences = %+v, want none", result.Sequences)
+	}
+}
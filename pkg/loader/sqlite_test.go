@@ -0,0 +1,277 @@
+package loader
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tendant/dbload/pkg/value"
+)
+
+// openTestDB opens an empty SQLite database in a temporary directory
+func openTestDB(t *testing.T, schema string) *sql.DB {
+	t.Helper()
+	db, err := openDatabase(sqliteDialect{}, "sqlite://"+filepath.Join(t.TempDir(), "seed.db"))
+	if err != nil {
+		t.Fatalf("openDatabase() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatalf("creating schema failed: %v", err)
+	}
+	return db
+}
+
+func TestInsertTableSQLite(t *testing.T) {
+	db := openTestDB(t, `
+CREATE TABLE users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	email TEXT UNIQUE NOT NULL,
+	name TEXT,
+	role TEXT NOT NULL DEFAULT 'member'
+);
+CREATE TABLE orders (
+	id INTEGER PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	"order" TEXT
+);`)
+
+	store := newRowStore()
+	functions := value.New()
+	functions.Register("ref", store.refFunction())
+	opts := insertOptions{dialect: sqliteDialect{}, functions: functions, batchSize: 10}
+
+	users := &seedTable{
+		Rows: []map[string]interface{}{
+			{"email": "john@example.com", "name": "John", "role": "admin"},
+			{"email": "jane@example.com", "name": "Jane"},
+		},
+		Columns:     []string{"email", "name", "role"},
+		OnConflict:  conflictUpsert,
+		ConflictKey: []string{"email"},
+		Missing:     missingDefault,
+	}
+	if err := normalizeRows("users", users); err != nil {
+		t.Fatalf("normalizeRows() error = %v", err)
+	}
+	if err := insertTable(db, "users", users, opts, store); err != nil {
+		t.Fatalf("insertTable(users) error = %v", err)
+	}
+
+	// The generated id and the default role are returned by the database
+	id, err := store.ref("users", "2", "id")
+	if err != nil {
+		t.Fatalf("ref() error = %v", err)
+	}
+	if id != int64(2) {
+		t.Errorf("Expected generated id 2, got %v (%T)", id, id)
+	}
+	role, err := store.ref("users", "2", "role")
+	if err != nil || role != "member" {
+		t.Errorf("Expected default role member, got %v (error %v)", role, err)
+	}
+
+	// Running again with a changed name updates the existing row
+	users.Rows[0]["name"] = "Johnny"
+	if err := insertTable(db, "users", users, opts, newRowStore()); err != nil {
+		t.Fatalf("insertTable(users) again error = %v", err)
+	}
+	var name string
+	var count int
+	if err := db.QueryRow("SELECT name FROM users WHERE email = 'john@example.com'").Scan(&name); err != nil || name != "Johnny" {
+		t.Errorf("Expected upserted name Johnny, got %q (error %v)", name, err)
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count); err != nil || count != 2 {
+		t.Errorf("Expected 2 users, got %d (error %v)", count, err)
+	}
+
+	orders := &seedTable{
+		Rows: []map[string]interface{}{
+			{"id": 1, "user_id": "${ ref(users, 2, id) }", "order": "first"},
+		},
+		Columns:    []string{"id", "user_id", "order"},
+		OnConflict: conflictFail,
+		Missing:    missingDefault,
+	}
+	if err := insertTable(db, "orders", orders, opts, store); err != nil {
+		t.Fatalf("insertTable(orders) error = %v", err)
+	}
+	var userID int64
+	if err := db.QueryRow(`SELECT user_id FROM orders WHERE id = 1`).Scan(&userID); err != nil || userID != 2 {
+		t.Errorf("Expected order of user 2, got %d (error %v)", userID, err)
+	}
+
+	// The fail strategy reports duplicates
+	if err := insertTable(db, "orders", orders, opts, store); err == nil {
+		t.Errorf("Expected error inserting a duplicate with the fail strategy")
+	}
+}
+
+func TestLoadForeignKeysSQLite(t *testing.T) {
+	db := openTestDB(t, `
+CREATE TABLE users (id INTEGER PRIMARY KEY);
+CREATE TABLE orders (id INTEGER PRIMARY KEY, user_id INTEGER REFERENCES users(id));`)
+
+	deps, err := loadForeignKeys(db, sqliteDialect{})
+	if err != nil {
+		t.Fatalf("loadForeignKeys() error = %v", err)
+	}
+	sorted, err := sortTables([]string{"orders", "users"}, deps)
+	if err != nil {
+		t.Fatalf("sortTables() error = %v", err)
+	}
+	if sorted[0] != "users" || sorted[1] != "orders" {
+		t.Errorf("sortTables() = %v, want [users orders]", sorted)
+	}
+}
+
+func TestLoadColumnTypesSQLite(t *testing.T) {
+	db := openTestDB(t, `CREATE TABLE events (id INTEGER PRIMARY KEY, payload JSON, happened_at DATETIME, active BOOLEAN)`)
+
+	types, err := loadColumnTypes(db, sqliteDialect{}, "events")
+	if err != nil {
+		t.Fatalf("loadColumnTypes() error = %v", err)
+	}
+	want := map[string]int{"id": kindInteger, "payload": kindJSON, "happened_at": kindTimestamp, "active": kindBoolean}
+	for column, kind := range want {
+		if types[column].kind != kind {
+			t.Errorf("Expected column %s of kind %d, got %+v", column, kind, types[column])
+		}
+	}
+
+	// Values are converted to the column types before inserting
+	events := &seedTable{
+		Rows: []map[string]interface{}{
+			{"id": "1", "payload": map[string]interface{}{"a": 1}, "happened_at": "2024-05-01T12:30:00Z", "active": "yes"},
+		},
+		Columns:    []string{"id", "payload", "happened_at", "active"},
+		OnConflict: conflictFail,
+		Missing:    missingDefault,
+	}
+	if err := insertTable(db, "events", events, insertOptions{dialect: sqliteDialect{}, batchSize: 1}, newRowStore()); err != nil {
+		t.Fatalf("insertTable() error = %v", err)
+	}
+	var payload string
+	var active bool
+	if err := db.QueryRow(`SELECT payload, active FROM events WHERE id = 1`).Scan(&payload, &active); err != nil {
+		t.Fatalf("reading event failed: %v", err)
+	}
+	if payload != `{"a":1}` || !active {
+		t.Errorf("Expected converted values, got payload %q and active %v", payload, active)
+	}
+
+	events.Rows[0]["id"] = "two"
+	err = insertTable(db, "events", events, insertOptions{dialect: sqliteDialect{}, batchSize: 1}, newRowStore())
+	if err == nil || !strings.Contains(err.Error(), "events[1].id: invalid value for INTEGER column") {
+		t.Errorf("Expected a per-cell error, got %v", err)
+	}
+}
+
+func TestInsertTableTwiceSQLite(t *testing.T) {
+	db := openTestDB(t, `
+CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, email TEXT UNIQUE NOT NULL);`)
+
+	users := func(emails ...string) *seedTable {
+		table := &seedTable{Columns: []string{"email"}, OnConflict: conflictIgnore, ConflictKey: []string{"id"}, Missing: missingDefault}
+		for _, email := range emails {
+			table.Rows = append(table.Rows, map[string]interface{}{"email": email})
+		}
+		if err := normalizeRows("users", table); err != nil {
+			t.Fatalf("normalizeRows() error = %v", err)
+		}
+		return table
+	}
+	opts := insertOptions{dialect: sqliteDialect{}, batchSize: 2}
+	if err := insertTable(db, "users", users("john@example.com", "jane@example.com"), opts, newRowStore()); err != nil {
+		t.Fatalf("insertTable() error = %v", err)
+	}
+
+	// The second run skips the existing rows, including one in the same
+	// batch as a new row, and still records the ids of all rows
+	store := newRowStore()
+	if err := insertTable(db, "users", users("jane@example.com", "max@example.com", "john@example.com"), opts, store); err != nil {
+		t.Fatalf("insertTable() again error = %v", err)
+	}
+	rows := store.tableRows("users")
+	if len(rows) != 3 {
+		t.Fatalf("users rows = %v, want 3 rows", rows)
+	}
+	for _, row := range rows {
+		var id int64
+		if err := db.QueryRow("SELECT id FROM users WHERE email = ?", row["email"]).Scan(&id); err != nil || row["id"] != id {
+			t.Errorf("recorded row %v, want the id %d of the database (error %v)", row, id, err)
+		}
+	}
+}
+
+func TestLoadTransactionsSQLite(t *testing.T) {
+	// The second row of orders fails, between two tables that load
+	seed := `
+users:
+  - {id: 1, email: "john@example.com"}
+orders:
+  - {id: 1, user_id: 1}
+  - {id: 2, user_id: null}
+notes:
+  - {id: 1, text: "hello"}
+`
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr bool
+		// want holds the number of rows of each table after the load
+		want    map[string]int
+		wantLog string
+	}{
+		{
+			name:    "Failing row rolls back every table",
+			wantErr: true,
+			want:    map[string]int{"users": 0, "orders": 0, "notes": 0},
+			wantLog: "Transaction rolled back",
+		},
+		{
+			name:    "Without transaction the rows loaded before the failure stay",
+			opts:    []Option{WithoutTransaction()},
+			wantErr: true,
+			want:    map[string]int{"users": 1, "orders": 1, "notes": 0},
+		},
+		{
+			name:    "Savepoints skip the failing table and keep the others",
+			opts:    []Option{WithSavepoints()},
+			want:    map[string]int{"users": 1, "orders": 0, "notes": 1},
+			wantLog: "Skipping table 'orders'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t, `
+CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT NOT NULL);
+CREATE TABLE orders (id INTEGER PRIMARY KEY, user_id INTEGER NOT NULL);
+CREATE TABLE notes (id INTEGER PRIMARY KEY, text TEXT);`)
+			var log strings.Builder
+			l, err := New(append([]Option{WithDB(db), WithDriver("sqlite"), WithLog(&log)}, tt.opts...)...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			_, err = l.LoadBytes(t.Context(), []byte(seed))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadBytes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			for table, want := range tt.want {
+				var got int
+				if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&got); err != nil {
+					t.Fatal(err)
+				}
+				if got != want {
+					t.Errorf("%s has %d rows, want %d", table, got, want)
+				}
+			}
+			if !strings.Contains(log.String(), tt.wantLog) {
+				t.Errorf("log = %q, want %q", log.String(), tt.wantLog)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package loader
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Policies for columns that some rows of a table leave out
+const (
+	// missingDefault inserts the column default (DEFAULT)
+	missingDefault = "default"
+	// missingNull inserts NULL
+	missingNull = "null"
+)
+
+// sqlDefault marks a column that is inserted with the DEFAULT keyword
+type sqlDefault struct{}
+
+// String renders the marker as the keyword it stands for
+func (sqlDefault) String() string {
+	return "DEFAULT"
+}
+
+// Tags that mark how a cell is evaluated
+const (
+	// exprTag marks a cell that is evaluated as an expression
+	exprTag = "!expr"
+	// litTag marks a cell that is never evaluated
+	litTag = "!lit"
+)
+
+// expression is a cell tagged !expr
+type expression string
+
+// literal is a cell tagged !lit
+type literal string
+
+// seedTable holds the rows of a table in the seed file together with the
+// options that control how they are loaded. A table is either written as a
+// plain list of rows or as a mapping with a rows key and the options.
+type seedTable struct {
+	Rows []map[string]interface{} `yaml:"rows"`
+	// OnConflict is the conflict strategy (ignore, upsert, fail or replace)
+	OnConflict string `yaml:"on_conflict"`
+	// ConflictKey lists the columns that identify a row for upsert and replace
+	ConflictKey []string `yaml:"conflict_key"`
+	// Missing is the policy for columns a row leaves out (default or null)
+	Missing string `yaml:"missing"`
+	// Merge is how the table is merged with the same table from earlier
+	// seed files (append, replace or override)
+	Merge string `yaml:"merge"`
+	// MergeKey lists the columns that identify a row for override
+	MergeKey []string `yaml:"merge_key"`
+	// NaturalKey lists the columns that identify a row when cleaning,
+	// instead of the primary key
+	NaturalKey []string `yaml:"natural_key"`
+
+	// Columns is the union of the columns of all rows, in the order they
+	// first appear in the seed file
+	Columns []string `yaml:"-"`
+	// Types holds the column types read from the database, which the
+	// values are converted to before inserting
+	Types map[string]columnType `yaml:"-"`
+	// Position is where the table is declared in the seed file, and
+	// Positions locates each of its rows, for error messages
+	Position  position      `yaml:"-"`
+	Positions []rowPosition `yaml:"-"`
+	// Templates records the rows generated from template rows
+	Templates []rowTemplate `yaml:"-"`
+}
+
+// UnmarshalYAML accepts both the list and the mapping form of a table
+func (t *seedTable) UnmarshalYAML(node *yaml.Node) error {
+	rowsNode := node
+	if node.Kind == yaml.SequenceNode {
+		if err := node.Decode(&t.Rows); err != nil {
+			return err
+		}
+	} else {
+		// Decode through an alias type to avoid calling UnmarshalYAML recursively
+		type plain seedTable
+		if err := node.Decode((*plain)(t)); err != nil {
+			return err
+		}
+		rowsNode = mappingValue(node, "rows")
+
+		for _, option := range []string{"conflict_key", "merge_key", "natural_key"} {
+			if keyNode := mappingValue(node, option); keyNode != nil {
+				for _, columnNode := range keyNode.Content {
+					if err := validateColumnName(columnNode.Value); err != nil {
+						return nodeError(columnNode, fmt.Errorf("invalid %s column: %w", option, err))
+					}
+				}
+			}
+		}
+	}
+
+	if err := validateColumns(rowsNode); err != nil {
+		return err
+	}
+	if err := applyTags(rowsNode, t.Rows); err != nil {
+		return err
+	}
+	t.Columns = columnOrder(rowsNode, t.Rows)
+	t.Position = nodePosition(node)
+	t.Positions = rowPositions(rowsNode)
+	return t.expandTemplates(rowsNode)
+}
+
+// validateColumns checks the column names used as keys in the rows of a table
+func validateColumns(rowsNode *yaml.Node) error {
+	if rowsNode == nil || rowsNode.Kind != yaml.SequenceNode {
+		return nil
+	}
+	for _, rowNode := range rowsNode.Content {
+		rowNode = cellsNode(rowNode)
+		if rowNode.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 0; i < len(rowNode.Content); i += 2 {
+			keyNode := rowNode.Content[i]
+			if keyNode.Value == "<<" {
+				continue
+			}
+			if err := validateColumnName(keyNode.Value); err != nil {
+				return nodeError(keyNode, fmt.Errorf("invalid column name: %w", err))
+			}
+		}
+	}
+	return nil
+}
+
+// applyTags replaces the cells tagged !expr or !lit with expressions and
+// literals, since the tags are lost when the rows are decoded
+func applyTags(rowsNode *yaml.Node, rows []map[string]interface{}) error {
+	if rowsNode == nil || rowsNode.Kind != yaml.SequenceNode {
+		return nil
+	}
+	for i, rowNode := range rowsNode.Content {
+		if rowNode.Kind == yaml.AliasNode {
+			rowNode = rowNode.Alias
+		}
+		rowNode = cellsNode(rowNode)
+		if rowNode.Kind != yaml.MappingNode {
+			continue
+		}
+		cells := rowCells(rows[i])
+		for j := 0; j+1 < len(rowNode.Content); j += 2 {
+			column, valueNode := rowNode.Content[j].Value, rowNode.Content[j+1]
+			if valueNode.Tag != exprTag && valueNode.Tag != litTag {
+				continue
+			}
+			if valueNode.Kind != yaml.ScalarNode {
+				return nodeError(valueNode, fmt.Errorf("%s must be followed by a single value", valueNode.Tag))
+			}
+			if valueNode.Tag == exprTag {
+				cells[column] = expression(valueNode.Value)
+			} else {
+				cells[column] = literal(valueNode.Value)
+			}
+		}
+	}
+	return nil
+}
+
+// mappingValue returns the value node of a key in a mapping node
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// isVirtual reports whether a column is virtual: it can be referenced with
+// col() but is never inserted
+func isVirtual(column string) bool {
+	return strings.HasPrefix(column, "_")
+}
+
+// columnOrder collects the columns of all rows in the order their keys
+// appear in the YAML nodes. Columns that do not appear as plain keys, such
+// as those added by merge keys, follow in alphabetical order. Virtual
+// columns are left out.
+func columnOrder(rowsNode *yaml.Node, rows []map[string]interface{}) []string {
+	var columns []string
+	seen := map[string]bool{}
+	add := func(column string) {
+		if !seen[column] && !isVirtual(column) {
+			seen[column] = true
+			columns = append(columns, column)
+		}
+	}
+
+	if rowsNode != nil && rowsNode.Kind == yaml.SequenceNode {
+		for _, rowNode := range rowsNode.Content {
+			if rowNode.Kind == yaml.AliasNode {
+				rowNode = rowNode.Alias
+			}
+			rowNode = cellsNode(rowNode)
+			if rowNode.Kind != yaml.MappingNode {
+				continue
+			}
+			for i := 0; i < len(rowNode.Content); i += 2 {
+				if key := rowNode.Content[i].Value; key != "<<" {
+					add(key)
+				}
+			}
+		}
+	}
+
+	var rest []string
+	for _, row := range rows {
+		for column := range rowCells(row) {
+			if !seen[column] && !isVirtual(column) {
+				seen[column] = true
+				rest = append(rest, column)
+			}
+		}
+	}
+	sort.Strings(rest)
+	return append(columns, rest...)
+}
+
+// normalizeRows gives every row of a table the full column set, filling in
+// the columns a row leaves out according to the table's missing policy
+func normalizeRows(table string, t *seedTable) error {
+	var fill interface{}
+	switch t.Missing {
+	case missingDefault:
+		fill = sqlDefault{}
+	case missingNull:
+		fill = nil
+	default:
+		return fmt.Errorf("table %s: unknown missing policy %q (use %s or %s)", table, t.Missing, missingDefault, missingNull)
+	}
+
+	for i, row := range t.Rows {
+		// An empty list item decodes to a nil row
+		if row == nil {
+			row = map[string]interface{}{}
+			t.Rows[i] = row
+		}
+		for _, column := range t.Columns {
+			if _, ok := row[column]; !ok {
+				row[column] = fill
+			}
+		}
+	}
+	return nil
+}
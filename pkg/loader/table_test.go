@@ -0,0 +1,131 @@
+package loader
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestSeedTableColumns(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		columns []string
+	}{
+		{
+			name: "List form keeps key order",
+			input: `
+- name: John
+  id: 1
+- email: jane@example.com
+  name: Jane
+`,
+			columns: []string{"name", "id", "email"},
+		},
+		{
+			name: "Mapping form",
+			input: `
+on_conflict: upsert
+rows:
+  - zeta: 1
+    alpha: 2
+`,
+			columns: []string{"zeta", "alpha"},
+		},
+		{
+			name: "Merge keys follow in alphabetical order",
+			input: `
+- &base
+  status: active
+  role: user
+- <<: *base
+  name: Jane
+`,
+			columns: []string{"status", "role", "name"},
+		},
+		{
+			name: "Virtual columns are left out",
+			input: `
+- _password: secret
+  email: john@example.com
+  password_hash: "${ col(_password) | hash() }"
+`,
+			columns: []string{"email", "password_hash"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var table seedTable
+			if err := yaml.Unmarshal([]byte(tt.input), &table); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(table.Columns, tt.columns) {
+				t.Errorf("Columns = %v, want %v", table.Columns, tt.columns)
+			}
+		})
+	}
+}
+
+func TestNormalizeRows(t *testing.T) {
+	newTable := func(missing string) *seedTable {
+		return &seedTable{
+			Rows: []map[string]interface{}{
+				{"id": 1, "name": "John"},
+				{"id": 2},
+				nil,
+			},
+			Columns: []string{"id", "name"},
+			Missing: missing,
+		}
+	}
+
+	table := newTable(missingDefault)
+	if err := normalizeRows("users", table); err != nil {
+		t.Fatalf("normalizeRows() error = %v", err)
+	}
+	if _, ok := table.Rows[1]["name"].(sqlDefault); !ok {
+		t.Errorf("Expected DEFAULT for missing column, got %v", table.Rows[1]["name"])
+	}
+	if len(table.Rows[2]) != 2 {
+		t.Errorf("Expected empty row to get all columns, got %v", table.Rows[2])
+	}
+
+	table = newTable(missingNull)
+	if err := normalizeRows("users", table); err != nil {
+		t.Fatalf("normalizeRows() error = %v", err)
+	}
+	if v, ok := table.Rows[1]["name"]; !ok || v != nil {
+		t.Errorf("Expected NULL for missing column, got %v", v)
+	}
+
+	if err := normalizeRows("users", newTable("skip")); err == nil {
+		t.Errorf("Expected error for unknown missing policy")
+	}
+}
+
+func TestSeedTableTags(t *testing.T) {
+	var table seedTable
+	input := `
+- id: !expr uuid(user-1)
+  bio: !lit "Call me (maybe) ${ later }"
+  note: plain|text
+`
+	if err := yaml.Unmarshal([]byte(input), &table); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	want := map[string]interface{}{
+		"id":   expression("uuid(user-1)"),
+		"bio":  literal("Call me (maybe) ${ later }"),
+		"note": "plain|text",
+	}
+	if !reflect.DeepEqual(table.Rows[0], want) {
+		t.Errorf("Rows[0] = %#v, want %#v", table.Rows[0], want)
+	}
+
+	err := yaml.Unmarshal([]byte("- tags: !expr [a, b]\n"), &table)
+	if err == nil || err.Error() != "1:9: !expr must be followed by a single value" {
+		t.Errorf("Expected error for tagged list, got %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package loader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Keys of a row that generates rows from a template
+const (
+	repeatKey   = "_repeat"
+	templateKey = "_template"
+)
+
+// indexVariable is replaced with the 1-based number of each generated row
+const indexVariable = "{{i}}"
+
+// rowTemplate records the rows generated from a template row
+type rowTemplate struct {
+	position
+	// start is the index of the first generated row, and count the number
+	// of generated rows
+	start int
+	count int
+}
+
+// cellsNode returns the node holding the cells of a row: the _template
+// mapping of a template row, or the row itself
+func cellsNode(rowNode *yaml.Node) *yaml.Node {
+	if rowNode.Kind == yaml.MappingNode && mappingValue(rowNode, repeatKey) != nil {
+		if template := mappingValue(rowNode, templateKey); template != nil && template.Kind == yaml.MappingNode {
+			return template
+		}
+	}
+	return rowNode
+}
+
+// rowCells returns the cells of the i-th decoded row, which are those of
+// its template for template rows
+func rowCells(row map[string]interface{}) map[string]interface{} {
+	if _, ok := row[repeatKey]; ok {
+		if template, ok := row[templateKey].(map[string]interface{}); ok {
+			return template
+		}
+	}
+	return row
+}
+
+// expandTemplates replaces every template row of a table with the rows it
+// generates, each with {{i}} replaced by its number
+func (t *seedTable) expandTemplates(rowsNode *yaml.Node) error {
+	if rowsNode == nil || rowsNode.Kind != yaml.SequenceNode {
+		return nil
+	}
+
+	var rows []map[string]interface{}
+	var positions []rowPosition
+	for i, rowNode := range rowsNode.Content {
+		repeatNode := mappingValue(rowNode, repeatKey)
+		if repeatNode == nil {
+			rows = append(rows, t.Rows[i])
+			positions = append(positions, t.Positions[i])
+			continue
+		}
+
+		count, err := parseTemplate(rowNode, repeatNode)
+		if err != nil {
+			return err
+		}
+		template := rowCells(t.Rows[i])
+		t.Templates = append(t.Templates, rowTemplate{position: nodePosition(rowNode), start: len(rows), count: count})
+		for n := 1; n <= count; n++ {
+			row := make(map[string]interface{}, len(template))
+			for column, v := range template {
+				row[column] = substituteIndex(v, n)
+			}
+			rows = append(rows, row)
+			positions = append(positions, t.Positions[i])
+		}
+	}
+	t.Rows, t.Positions = rows, positions
+	return nil
+}
+
+// parseTemplate checks a template row and returns its repeat count
+func parseTemplate(rowNode, repeatNode *yaml.Node) (int, error) {
+	count, err := strconv.Atoi(repeatNode.Value)
+	if repeatNode.Kind != yaml.ScalarNode || err != nil || count < 0 {
+		return 0, nodeError(repeatNode, fmt.Errorf("%s must be a number of rows, got %q", repeatKey, repeatNode.Value))
+	}
+	templateNode := mappingValue(rowNode, templateKey)
+	if templateNode == nil || templateNode.Kind != yaml.MappingNode {
+		return 0, nodeError(rowNode, fmt.Errorf("%s requires a %s mapping with the columns of the rows", repeatKey, templateKey))
+	}
+	for i := 0; i < len(rowNode.Content); i += 2 {
+		if key := rowNode.Content[i].Value; key != repeatKey && key != templateKey {
+			return 0, nodeError(rowNode.Content[i], fmt.Errorf("unexpected %s in a template row (put the columns under %s)", key, templateKey))
+		}
+	}
+	return count, nil
+}
+
+// substituteIndex replaces {{i}} with n in the strings and expressions of a
+// value. Literals tagged !lit are kept as written.
+func substituteIndex(v interface{}, n int) interface{} {
+	index := strconv.Itoa(n)
+	switch v := v.(type) {
+	case string:
+		return strings.ReplaceAll(v, indexVariable, index)
+	case expression:
+		return expression(strings.ReplaceAll(string(v), indexVariable, index))
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[k] = substituteIndex(item, n)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = substituteIndex(item, n)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// generated reports whether the rows from start to start+n are all
+// generated from templates and none of them is the first row of its
+// template. Dry runs only print the first row of each template.
+func (t *seedTable) generated(start, n int) bool {
+	for i := start; i < start+n; i++ {
+		hidden := false
+		for _, tmpl := range t.Templates {
+			if i > tmpl.start && i < tmpl.start+tmpl.count {
+				hidden = true
+				break
+			}
+		}
+		if !hidden {
+			return false
+		}
+	}
+	return n > 0
+}
@@ -0,0 +1,87 @@
+package loader
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestExpandTemplates(t *testing.T) {
+	input := `
+- id: 0
+  email: admin@example.com
+- _repeat: 3
+  _template:
+    email: "user{{i}}@example.com"
+    id: !expr "{{i}}"
+    note: !lit "{{i}}"
+    tags: ["t{{i}}", 2]
+- id: 9
+`
+	var table seedTable
+	if err := yaml.Unmarshal([]byte(input), &table); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	if want := []string{"id", "email", "note", "tags"}; !reflect.DeepEqual(table.Columns, want) {
+		t.Errorf("Columns = %v, want %v", table.Columns, want)
+	}
+	want := []map[string]interface{}{
+		{"id": 0, "email": "admin@example.com"},
+		{"id": expression("1"), "email": "user1@example.com", "note": literal("{{i}}"), "tags": []interface{}{"t1", 2}},
+		{"id": expression("2"), "email": "user2@example.com", "note": literal("{{i}}"), "tags": []interface{}{"t2", 2}},
+		{"id": expression("3"), "email": "user3@example.com", "note": literal("{{i}}"), "tags": []interface{}{"t3", 2}},
+		{"id": 9},
+	}
+	if !reflect.DeepEqual(table.Rows, want) {
+		t.Errorf("Rows = %v, want %v", table.Rows, want)
+	}
+
+	// Generated rows are reported at the cells of the template
+	if len(table.Positions) != len(want) || table.Positions[3].cells["email"].line != 6 || table.Positions[4].line != 10 {
+		t.Errorf("Positions = %v", table.Positions)
+	}
+	if want := []rowTemplate{{position: position{line: 4, column: 3}, start: 1, count: 3}}; !reflect.DeepEqual(table.Templates, want) {
+		t.Errorf("Templates = %v, want %v", table.Templates, want)
+	}
+
+	for _, tt := range []struct {
+		start, n int
+		want     bool
+	}{
+		{start: 0, n: 1, want: false},
+		{start: 1, n: 1, want: false},
+		{start: 2, n: 2, want: true},
+		{start: 3, n: 2, want: false},
+	} {
+		if got := table.generated(tt.start, tt.n); got != tt.want {
+			t.Errorf("generated(%d, %d) = %v, want %v", tt.start, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestExpandTemplatesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{name: "Count is not a number", input: "- _repeat: many\n  _template: {a: 1}", wantErr: `1:12: _repeat must be a number of rows, got "many"`},
+		{name: "Negative count", input: "- _repeat: -1\n  _template: {a: 1}", wantErr: `_repeat must be a number of rows, got "-1"`},
+		{name: "Missing template", input: "- _repeat: 2\n  a: 1", wantErr: "1:3: _repeat requires a _template mapping"},
+		{name: "Column next to the template", input: "- _repeat: 2\n  _template: {a: 1}\n  b: 2", wantErr: "3:3: unexpected b in a template row"},
+		{name: "Invalid column in template", input: "- _repeat: 2\n  _template: {\"a b\": 1}", wantErr: "invalid column name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var table seedTable
+			err := yaml.Unmarshal([]byte(tt.input), &table)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Unmarshal() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
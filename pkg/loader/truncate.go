@@ -0,0 +1,87 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// connector is implemented by the database handles holding a pool of
+// connections, such as *sql.DB
+type connector interface {
+	Conn(ctx context.Context) (*sql.Conn, error)
+}
+
+// truncateTables empties the tables to truncate before they are loaded
+func (l *Loader) truncateTables(conn execer, s *seedLoader, order []string) error {
+	if !l.truncate {
+		return nil
+	}
+	for _, table := range l.truncateOnly {
+		if _, ok := s.tables[table]; !ok {
+			return fmt.Errorf("cannot truncate %s: the table is not in the seed files", table)
+		}
+	}
+	var tables []string
+	for _, table := range order {
+		if len(l.truncateOnly) == 0 || slices.Contains(l.truncateOnly, table) {
+			tables = append(tables, table)
+		}
+	}
+
+	fmt.Fprintf(l.log, "Truncating tables: %s\n", strings.Join(tables, ", "))
+	stmts := l.dialect.truncateStatements(tables)
+	if l.dryRun {
+		for _, stmt := range stmts {
+			fmt.Fprintf(l.out, "SQL: %s\n", stmt)
+			fmt.Fprintln(l.out, "---")
+		}
+		return nil
+	}
+	if d, ok := l.dialect.(sqliteDialect); ok {
+		reset, err := d.resetSequences(conn, tables)
+		if err != nil {
+			return fmt.Errorf("truncate failed: %w", dbError(err))
+		}
+		if reset != "" {
+			stmts = append(stmts, reset)
+		}
+	}
+	for _, stmt := range stmts {
+		if _, err := conn.Exec(stmt); err != nil {
+			return fmt.Errorf("truncate failed: %w", dbError(err))
+		}
+	}
+	return nil
+}
+
+// truncateFirst empties the tables before the load's transaction starts,
+// for the databases where truncating commits implicitly. The statements
+// run on a single connection, which is discarded when they fail, so that
+// no connection with changed session settings returns to the pool.
+func (l *Loader) truncateFirst(ctx context.Context, s *seedLoader, order []string) error {
+	if !l.truncate {
+		return nil
+	}
+	pool, ok := l.db.(connector)
+	if l.dryRun || !ok {
+		return l.truncateTables(contextConn{ctx: ctx, db: l.db}, s, order)
+	}
+
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("truncate failed: %w", err)
+	}
+	defer conn.Close()
+	if err := l.truncateTables(contextConn{ctx: ctx, db: conn}, s, order); err != nil {
+		conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		return err
+	}
+	if l.useTx {
+		fmt.Fprintf(l.log, "Truncating commits implicitly on %s, so the truncated tables are not restored if the load fails.\n", l.dialect.name())
+	}
+	return nil
+}
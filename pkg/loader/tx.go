@@ -0,0 +1,112 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// savepointName is the savepoint used to isolate each table in savepoint mode
+const savepointName = "dbload_table"
+
+// execer is the subset of *sql.DB and *sql.Tx used to load the seed data
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// contextConn runs the statements of a load on a database handle with the
+// context of the load
+type contextConn struct {
+	ctx context.Context
+	db  DB
+}
+
+func (c contextConn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.db.ExecContext(c.ctx, query, args...)
+}
+
+func (c contextConn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.db.QueryContext(c.ctx, query, args...)
+}
+
+// beginner is implemented by the database handles that can start a
+// transaction, *sql.DB and *sql.Conn
+type beginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// beginLoad starts the transaction the seed data is loaded in, deferring
+// all deferrable constraints until commit when requested
+func beginLoad(ctx context.Context, db beginner, d dialect, deferred bool) (*sql.Tx, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction failed: %w", err)
+	}
+	if deferred {
+		if err := deferConstraints(ctx, tx, d); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	return tx, nil
+}
+
+// deferConstraints defers all deferrable constraints of a transaction
+// until commit
+func deferConstraints(ctx context.Context, tx *sql.Tx, d dialect) error {
+	stmt := d.deferConstraints()
+	if stmt == "" {
+		return fmt.Errorf("deferring constraints is not supported for %s", d.name())
+	}
+	if _, err := tx.ExecContext(ctx, stmt); err != nil {
+		return fmt.Errorf("deferring constraints failed: %w", err)
+	}
+	return nil
+}
+
+// copyTx returns a transaction to run COPY in: the transaction of db when
+// it has one, or a new transaction that the caller commits, reported by
+// owned
+func copyTx(db execer) (tx *sql.Tx, owned bool, err error) {
+	ctx := context.Background()
+	var handle interface{} = db
+	if c, ok := db.(contextConn); ok {
+		ctx, handle = c.ctx, c.db
+	}
+	switch handle := handle.(type) {
+	case *sql.Tx:
+		return handle, false, nil
+	case beginner:
+		tx, err := handle.BeginTx(ctx, nil)
+		return tx, true, err
+	default:
+		return nil, false, fmt.Errorf("COPY is not supported on a %T", handle)
+	}
+}
+
+// runSavepoint runs fn inside a savepoint. When fn fails, the work done since
+// the savepoint is rolled back and the error of fn is returned as skipped so
+// that the caller can continue with the rest of the transaction. err is only
+// set when the savepoint itself could not be created, rolled back or released.
+func runSavepoint(tx execer, d dialect, fn func() error) (skipped error, err error) {
+	create, rollback, release := d.savepoint(savepointName)
+	if _, err := tx.Exec(create); err != nil {
+		return nil, fmt.Errorf("creating savepoint failed: %w", err)
+	}
+
+	if fnErr := fn(); fnErr != nil {
+		if _, err := tx.Exec(rollback); err != nil {
+			return nil, fmt.Errorf("rollback to savepoint failed after %v: %w", fnErr, err)
+		}
+		return fnErr, nil
+	}
+
+	if release == "" {
+		return nil, nil
+	}
+	if _, err := tx.Exec(release); err != nil {
+		return nil, fmt.Errorf("releasing savepoint failed: %w", err)
+	}
+	return nil, nil
+}
@@ -0,0 +1,56 @@
+package value
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/blowfish"
+)
+
+// bcryptEncoding is the base64 alphabet used by bcrypt
+var bcryptEncoding = base64.NewEncoding("./ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789").WithPadding(base64.NoPadding)
+
+// bcryptMagic is the text encrypted to produce a bcrypt hash
+var bcryptMagic = []byte("OrpheanBeholderScryDoubt")
+
+// bcryptFromReader hashes password like bcrypt.GenerateFromPassword, but
+// reads the salt from r, so that a seeded reader produces the same hash on
+// every run. The bcrypt package draws its salt from crypto/rand and offers
+// no way to pass one, so -seed could not make bcrypt() reproducible
+// otherwise; the key schedule itself is left to its blowfish package. The
+// tests compare the hashes with published bcrypt test vectors.
+//
+// Seeded hashes are for test data only, since their salts are predictable.
+// Without a seed, bcrypt() uses the bcrypt package.
+func bcryptFromReader(password []byte, cost int, r io.Reader) (string, error) {
+	if len(password) > 72 {
+		return "", bcrypt.ErrPasswordTooLong
+	}
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(r, salt); err != nil {
+		return "", err
+	}
+
+	// C implementations use the trailing NUL of the key during expansion
+	key := append(password[:len(password):len(password)], 0)
+	c, err := blowfish.NewSaltedCipher(key, salt)
+	if err != nil {
+		return "", err
+	}
+	for i := uint64(0); i < 1<<uint(cost); i++ {
+		blowfish.ExpandKey(key, c)
+		blowfish.ExpandKey(salt, c)
+	}
+
+	data := append([]byte{}, bcryptMagic...)
+	for i := 0; i < len(data); i += 8 {
+		for j := 0; j < 64; j++ {
+			c.Encrypt(data[i:i+8], data[i:i+8])
+		}
+	}
+
+	// Only 23 of the 24 encrypted bytes are encoded, as in other implementations
+	return fmt.Sprintf("$2a$%02d$%s%s", cost, bcryptEncoding.EncodeToString(salt), bcryptEncoding.EncodeToString(data[:23])), nil
+}
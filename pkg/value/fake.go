@@ -0,0 +1,231 @@
+package value
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxLoremWords is the largest number of words fake.lorem() generates
+const maxLoremWords = 5000
+
+// globalSource draws from the automatically seeded functions of math/rand,
+// which are safe for concurrent use
+type globalSource struct{}
+
+func (globalSource) Int63() int64 { return rand.Int63() }
+func (globalSource) Seed(int64)   {}
+
+// random returns the seeded source of randomness of the context, or a
+// randomly seeded one
+func (c *Context) random() *rand.Rand {
+	if r := c.seeded(); r != nil {
+		return r
+	}
+	return rand.New(globalSource{})
+}
+
+// locale returns the data for the locale of the context
+func (c *Context) locale() (*fakeLocale, error) {
+	name := defaultLocale
+	if c != nil && c.Locale != "" {
+		name = c.Locale
+	}
+	l, ok := fakeLocales[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported locale %q (use %s)", name, strings.Join(Locales(), ", "))
+	}
+	return l, nil
+}
+
+// Locales returns the locales supported by the fake.* functions
+func Locales() []string {
+	names := make([]string, 0, len(fakeLocales))
+	for name := range fakeLocales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pick returns a random item of items
+func pick[T any](r *rand.Rand, items []T) T {
+	return items[r.Intn(len(items))]
+}
+
+// digits replaces each # in format with a random digit
+func digits(r *rand.Rand, format string) string {
+	var b strings.Builder
+	for _, c := range format {
+		if c == '#' {
+			b.WriteByte(byte('0' + r.Intn(10)))
+		} else {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// slug turns text into lowercase ASCII for email addresses and host names
+func (l *fakeLocale) slug(text string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(text) {
+		switch {
+		case l.transliterate[c] != "":
+			b.WriteString(l.transliterate[c])
+		case c >= 'a' && c <= 'z' || c >= '0' && c <= '9':
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// localeFunction registers a fake.* function without parameters that draws
+// from the data of the context's locale
+func localeFunction(name string, generate func(r *rand.Rand, l *fakeLocale) string) {
+	builtin(name, Function{
+		Handler: func(ctx *Context, _ []interface{}) (interface{}, error) {
+			l, err := ctx.locale()
+			if err != nil {
+				return nil, err
+			}
+			return generate(ctx.random(), l), nil
+		},
+	})
+}
+
+// init registers the fake.* functions, which generate random but realistic
+// data. With a seeded context they return the same values on every run.
+func init() {
+	localeFunction("fake.name", func(r *rand.Rand, l *fakeLocale) string {
+		return pick(r, l.firstNames) + " " + pick(r, l.lastNames)
+	})
+
+	localeFunction("fake.email", func(r *rand.Rand, l *fakeLocale) string {
+		return fmt.Sprintf("%s.%s%d@%s", l.slug(pick(r, l.firstNames)), l.slug(pick(r, l.lastNames)), r.Intn(100), pick(r, emailDomains))
+	})
+
+	localeFunction("fake.phone", func(r *rand.Rand, l *fakeLocale) string {
+		return digits(r, pick(r, l.phoneFormats))
+	})
+
+	localeFunction("fake.address", func(r *rand.Rand, l *fakeLocale) string {
+		city := pick(r, l.cities)
+		number := fmt.Sprint(1 + r.Intn(9999))
+		return fmt.Sprintf(l.addressFormat, number, pick(r, l.streets), city.name, city.region, digits(r, l.postalCode))
+	})
+
+	localeFunction("fake.company", func(r *rand.Rand, l *fakeLocale) string {
+		return fmt.Sprintf(pick(r, l.companyFormats), pick(r, l.lastNames), pick(r, l.lastNames))
+	})
+
+	builtin("fake.ipv4", Function{
+		Handler: func(ctx *Context, _ []interface{}) (interface{}, error) {
+			r := ctx.random()
+			return fmt.Sprintf("%d.%d.%d.%d", 1+r.Intn(223), r.Intn(256), r.Intn(256), 1+r.Intn(254)), nil
+		},
+	})
+
+	localeFunction("fake.url", func(r *rand.Rand, l *fakeLocale) string {
+		return fmt.Sprintf("https://www.%s.%s/%s", l.slug(pick(r, l.lastNames)), l.tld, pick(r, loremWords))
+	})
+
+	// fake.lorem(words) returns a sentence of lorem ipsum, 10 words by
+	// default and at most maxLoremWords
+	builtin("fake.lorem", Function{
+		Params: []Param{{Name: "words", Type: Int, Optional: true}},
+		Handler: func(ctx *Context, args []interface{}) (interface{}, error) {
+			n := int64(10)
+			if len(args) == 1 {
+				n = args[0].(int64)
+			}
+			if n < 1 || n > maxLoremWords {
+				return nil, fmt.Errorf("words must be between 1 and %d, got %d", maxLoremWords, n)
+			}
+			r := ctx.random()
+			words := make([]string, n)
+			for i := range words {
+				words[i] = pick(r, loremWords)
+			}
+			words[0] = strings.ToUpper(words[0][:1]) + words[0][1:]
+			return strings.Join(words, " ") + ".", nil
+		},
+	})
+
+	// fake.int(min, max) returns an integer between min and max, inclusive
+	builtin("fake.int", Function{
+		Params: []Param{{Name: "min", Type: Int}, {Name: "max", Type: Int}},
+		Handler: func(ctx *Context, args []interface{}) (interface{}, error) {
+			min, max := args[0].(int64), args[1].(int64)
+			if min > max {
+				return nil, fmt.Errorf("min %d is greater than max %d", min, max)
+			}
+			span := uint64(max - min)
+			if span == math.MaxUint64 {
+				return int64(ctx.random().Uint64()), nil
+			}
+			return min + int64(ctx.random().Uint64()%(span+1)), nil
+		},
+	})
+
+	// fake.float([min, max, [decimals]]) returns a number between min and
+	// max, by default between 0 and 1, rounded to decimals places if given
+	builtin("fake.float", Function{
+		Params: []Param{
+			{Name: "min", Type: Float, Optional: true},
+			{Name: "max", Type: Float, Optional: true},
+			{Name: "decimals", Type: Int, Optional: true},
+		},
+		Handler: func(ctx *Context, args []interface{}) (interface{}, error) {
+			min, max := 0.0, 1.0
+			switch len(args) {
+			case 1:
+				return nil, fmt.Errorf("min requires a max")
+			case 2, 3:
+				min, max = args[0].(float64), args[1].(float64)
+			}
+			if min > max {
+				return nil, fmt.Errorf("min %g is greater than max %g", min, max)
+			}
+			f := min + ctx.random().Float64()*(max-min)
+			if len(args) == 3 {
+				scale := math.Pow(10, float64(args[2].(int64)))
+				f = math.Round(f*scale) / scale
+			}
+			return f, nil
+		},
+	})
+
+	// fake.date([from, to]) returns a date between from and to, by default
+	// within the year before the current time of the context
+	builtin("fake.date", Function{
+		Params: []Param{{Name: "from", Type: Time, Optional: true}, {Name: "to", Type: Time, Optional: true}},
+		Handler: func(ctx *Context, args []interface{}) (interface{}, error) {
+			to := ctx.Now().UTC()
+			from := to.AddDate(-1, 0, 0)
+			switch len(args) {
+			case 1:
+				return nil, fmt.Errorf("from requires a to date")
+			case 2:
+				from, to = args[0].(time.Time), args[1].(time.Time)
+			}
+			days := int(to.Sub(from).Hours() / 24)
+			if days < 0 {
+				return nil, fmt.Errorf("from %s is after to %s", from.Format("2006-01-02"), to.Format("2006-01-02"))
+			}
+			return from.AddDate(0, 0, ctx.random().Intn(days+1)).Format("2006-01-02"), nil
+		},
+	})
+
+	// fake.pick(a, b, ...) returns one of its arguments
+	builtin("fake.pick", Function{
+		Params:   []Param{{Name: "choices", Type: Any}},
+		Variadic: true,
+		Handler: func(ctx *Context, args []interface{}) (interface{}, error) {
+			return pick(ctx.random(), args), nil
+		},
+	})
+}
@@ -0,0 +1,110 @@
+package value
+
+// fakeLocale holds the data the fake.* functions draw from for a locale.
+// Formats use # for a random digit.
+type fakeLocale struct {
+	firstNames []string
+	lastNames  []string
+	// streets are street names, and addressFormat places the house number
+	// (%[1]s), street (%[2]s), city (%[3]s), region (%[4]s) and postal code (%[5]s)
+	streets       []string
+	cities        []fakeCity
+	addressFormat string
+	postalCode    string
+	phoneFormats  []string
+	// companyFormats place one (%[1]s) or two (%[2]s) last names
+	companyFormats []string
+	// transliterate replaces characters that cannot appear in email
+	// addresses and host names
+	transliterate map[rune]string
+	tld           string
+}
+
+// fakeCity is a city together with its region, such as a state
+type fakeCity struct {
+	name   string
+	region string
+}
+
+// defaultLocale is used when the context sets no locale
+const defaultLocale = "en_US"
+
+var fakeLocales = map[string]*fakeLocale{
+	"en_US": {
+		firstNames: []string{
+			"James", "Mary", "Robert", "Patricia", "John", "Jennifer", "Michael", "Linda",
+			"David", "Elizabeth", "William", "Barbara", "Richard", "Susan", "Joseph", "Jessica",
+			"Thomas", "Sarah", "Charles", "Karen", "Daniel", "Lisa", "Matthew", "Nancy",
+			"Anthony", "Betty", "Mark", "Sandra", "Steven", "Ashley", "Andrew", "Emily",
+		},
+		lastNames: []string{
+			"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis",
+			"Rodriguez", "Martinez", "Hernandez", "Lopez", "Wilson", "Anderson", "Thomas", "Taylor",
+			"Moore", "Jackson", "Martin", "Lee", "Thompson", "White", "Harris", "Clark",
+			"Lewis", "Robinson", "Walker", "Young", "Allen", "King", "Wright", "Scott",
+		},
+		streets: []string{
+			"Main Street", "Oak Street", "Pine Street", "Maple Avenue", "Cedar Lane", "Elm Street",
+			"Washington Avenue", "Lake Drive", "Hill Road", "Park Avenue", "Sunset Boulevard", "River Road",
+			"Church Street", "Highland Avenue", "Meadow Lane", "Forest Drive",
+		},
+		cities: []fakeCity{
+			{"Springfield", "IL"}, {"Portland", "OR"}, {"Austin", "TX"}, {"Madison", "WI"},
+			{"Columbus", "OH"}, {"Denver", "CO"}, {"Raleigh", "NC"}, {"Boise", "ID"},
+			{"Albany", "NY"}, {"Sacramento", "CA"}, {"Richmond", "VA"}, {"Tucson", "AZ"},
+		},
+		addressFormat: "%[1]s %[2]s, %[3]s, %[4]s %[5]s",
+		postalCode:    "#####",
+		phoneFormats:  []string{"(###) ###-####", "###-###-####", "+1 ###-###-####"},
+		companyFormats: []string{
+			"%[1]s Inc.", "%[1]s LLC", "%[1]s Group", "%[1]s & Sons", "%[1]s and %[2]s", "%[1]s-%[2]s",
+		},
+		tld: "com",
+	},
+	"de_DE": {
+		firstNames: []string{
+			"Maximilian", "Sophie", "Alexander", "Marie", "Paul", "Emma", "Lukas", "Hannah",
+			"Felix", "Mia", "Jonas", "Lena", "Leon", "Anna", "Finn", "Lea",
+			"Elias", "Johanna", "Jürgen", "Katharina", "Stefan", "Sabine", "Matthias", "Ursula",
+			"Andreas", "Monika", "Thomas", "Petra", "Michael", "Claudia", "Wolfgang", "Jörg",
+		},
+		lastNames: []string{
+			"Müller", "Schmidt", "Schneider", "Fischer", "Weber", "Meyer", "Wagner", "Becker",
+			"Schulz", "Hoffmann", "Schäfer", "Koch", "Bauer", "Richter", "Klein", "Wolf",
+			"Schröder", "Neumann", "Schwarz", "Zimmermann", "Braun", "Krüger", "Hofmann", "Hartmann",
+			"Lange", "Schmitt", "Werner", "Schmitz", "Krause", "Meier", "Lehmann", "Köhler",
+		},
+		streets: []string{
+			"Hauptstraße", "Schulstraße", "Gartenstraße", "Bahnhofstraße", "Dorfstraße", "Bergstraße",
+			"Birkenweg", "Lindenstraße", "Kirchstraße", "Waldstraße", "Ringstraße", "Schillerstraße",
+			"Goethestraße", "Am Markt", "Mühlenweg", "Rosenweg",
+		},
+		cities: []fakeCity{
+			{"Berlin", ""}, {"Hamburg", ""}, {"München", ""}, {"Köln", ""},
+			{"Frankfurt am Main", ""}, {"Stuttgart", ""}, {"Düsseldorf", ""}, {"Leipzig", ""},
+			{"Dresden", ""}, {"Hannover", ""}, {"Nürnberg", ""}, {"Bremen", ""},
+		},
+		addressFormat: "%[2]s %[1]s, %[5]s %[3]s",
+		postalCode:    "#####",
+		phoneFormats:  []string{"+49 ### #######", "0### #######", "+49 (0)## ########"},
+		companyFormats: []string{
+			"%[1]s GmbH", "%[1]s AG", "%[1]s GmbH & Co. KG", "%[1]s & %[2]s", "%[1]s %[2]s OHG",
+		},
+		transliterate: map[rune]string{'ä': "ae", 'ö': "oe", 'ü': "ue", 'ß': "ss"},
+		tld:           "de",
+	},
+}
+
+// loremWords are the words of fake.lorem
+var loremWords = []string{
+	"lorem", "ipsum", "dolor", "sit", "amet", "consectetur", "adipiscing", "elit",
+	"sed", "do", "eiusmod", "tempor", "incididunt", "ut", "labore", "et",
+	"dolore", "magna", "aliqua", "enim", "ad", "minim", "veniam", "quis",
+	"nostrud", "exercitation", "ullamco", "laboris", "nisi", "aliquip", "ex", "ea",
+	"commodo", "consequat", "duis", "aute", "irure", "in", "reprehenderit", "voluptate",
+	"velit", "esse", "cillum", "fugiat", "nulla", "pariatur", "excepteur", "sint",
+}
+
+// emailDomains are the domains of fake.email, which are reserved for
+// examples and never deliver mail
+var emailDomains = []string{"example.com", "example.org", "example.net"}
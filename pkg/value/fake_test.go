@@ -0,0 +1,102 @@
+package value
+
+import (
+	"math/rand"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFakeFunctions(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	newContext := func(locale string, seed int64) *Context {
+		return &Context{
+			Locale: locale,
+			Clock:  func() time.Time { return now },
+			Random: rand.New(rand.NewSource(seed)),
+		}
+	}
+
+	tests := []struct {
+		input string
+		check func(v interface{}) bool
+	}{
+		{input: "fake.name()", check: matches(`^\pL+ \pL+$`)},
+		{input: "fake.email()", check: matches(`^[a-z]+\.[a-z]+[0-9]*@example\.(com|org|net)$`)},
+		{input: "fake.phone()", check: matches(`^[-+()0-9 ]+$`)},
+		{input: "fake.address()", check: matches(`[0-9]+.*, `)},
+		{input: "fake.company()", check: matches(`^\pL`)},
+		{input: "fake.lorem(3)", check: matches(`^[A-Z][a-z]* [a-z]+ [a-z]+\.$`)},
+		{input: "fake.lorem()", check: func(v interface{}) bool { return len(strings.Fields(v.(string))) == 10 }},
+		{input: "fake.int(-2, 2)", check: func(v interface{}) bool { return v.(int64) >= -2 && v.(int64) <= 2 }},
+		{input: "fake.float()", check: func(v interface{}) bool { return v.(float64) >= 0 && v.(float64) < 1 }},
+		{input: "fake.float(10, 20, 1)", check: func(v interface{}) bool { f := v.(float64); return f >= 10 && f <= 20 && f*10 == float64(int(f*10)) }},
+		{input: "fake.date()", check: func(v interface{}) bool { return v.(string) >= "2023-05-01" && v.(string) <= "2024-05-01" }},
+		{input: "fake.date(2020-01-01, 2020-01-03)", check: func(v interface{}) bool { return v.(string) >= "2020-01-01" && v.(string) <= "2020-01-03" }},
+		{input: "fake.ipv4()", check: func(v interface{}) bool { return net.ParseIP(v.(string)).To4() != nil }},
+		{input: "fake.url()", check: matches(`^https://www\.[a-z]+\.(com|de)/[a-z]+$`)},
+		{input: "fake.pick(red, green, blue)", check: func(v interface{}) bool { return strings.Contains("red green blue", v.(string)) }},
+	}
+
+	for _, locale := range Locales() {
+		for _, tt := range tests {
+			t.Run(locale+" "+tt.input, func(t *testing.T) {
+				for seed := int64(0); seed < 20; seed++ {
+					got, err := EvalExprContext(newContext(locale, seed), tt.input)
+					if err != nil {
+						t.Fatalf("EvalExprContext() error = %v", err)
+					}
+					if !tt.check(got) {
+						t.Fatalf("EvalExprContext() = %#v with seed %d", got, seed)
+					}
+					if again, _ := EvalExprContext(newContext(locale, seed), tt.input); again != got {
+						t.Fatalf("EvalExprContext() = %#v, then %#v with seed %d", got, again, seed)
+					}
+				}
+			})
+		}
+	}
+
+	// Locale data differs
+	us, _ := EvalExprContext(newContext("en_US", 1), "fake.url()")
+	de, _ := EvalExprContext(newContext("de_DE", 1), "fake.url()")
+	if !strings.Contains(us.(string), ".com/") || !strings.Contains(de.(string), ".de/") {
+		t.Errorf("fake.url() = %v for en_US and %v for de_DE", us, de)
+	}
+}
+
+func TestFakeFunctionErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		locale  string
+		wantErr string
+	}{
+		{input: "fake.name()", locale: "xx_XX", wantErr: `unsupported locale "xx_XX" (use de_DE, en_US)`},
+		{input: "fake.int(5, 1)", wantErr: "min 5 is greater than max 1"},
+		{input: "fake.int(a, 1)", wantErr: `argument 1 (min): expected an integer, got "a"`},
+		{input: "fake.float(1)", wantErr: "min requires a max"},
+		{input: "fake.lorem(0)", wantErr: "words must be between 1 and 5000, got 0"},
+		{input: "fake.lorem(1000000000)", wantErr: "words must be between 1 and 5000, got 1000000000"},
+		{input: "fake.date(2020-02-01, 2020-01-01)", wantErr: "from 2020-02-01 is after to 2020-01-01"},
+		{input: "fake.pick()", wantErr: "requires at least 1 argument"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := EvalExprContext(&Context{Locale: tt.locale}, tt.input)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("EvalExprContext() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func matches(pattern string) func(v interface{}) bool {
+	re := regexp.MustCompile(pattern)
+	return func(v interface{}) bool {
+		s, ok := v.(string)
+		return ok && re.MatchString(s)
+	}
+}
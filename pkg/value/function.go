@@ -0,0 +1,316 @@
+package value
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Type is the type of a function parameter. Arguments are converted to the
+// Go type of their parameter before the handler is called.
+type Type int
+
+const (
+	// Any passes the argument as it was evaluated
+	Any Type = iota
+	// String passes a string. Literals are passed as written, so 007 stays "007".
+	String
+	// Int passes an int64
+	Int
+	// Float passes a float64
+	Float
+	// Bool passes a bool
+	Bool
+	// Time passes a time.Time
+	Time
+	// Bytes passes a []byte
+	Bytes
+)
+
+// String returns the name of the type used in error messages
+func (t Type) String() string {
+	switch t {
+	case String:
+		return "a string"
+	case Int:
+		return "an integer"
+	case Float:
+		return "a number"
+	case Bool:
+		return "a boolean"
+	case Time:
+		return "a timestamp"
+	case Bytes:
+		return "bytes"
+	default:
+		return "a value"
+	}
+}
+
+// keyword returns the short name of the type used in signatures
+func (t Type) keyword() string {
+	switch t {
+	case String:
+		return "string"
+	case Int:
+		return "int"
+	case Float:
+		return "float"
+	case Bool:
+		return "bool"
+	case Time:
+		return "time"
+	case Bytes:
+		return "bytes"
+	default:
+		return "any"
+	}
+}
+
+// Param describes a parameter of a function
+type Param struct {
+	Name string
+	Type Type
+	// Optional parameters may be left out. Only the last parameters of a
+	// function can be optional.
+	Optional bool
+}
+
+// Context describes the cell an expression is evaluated for. Handlers
+// receive a nil Context when an expression is evaluated on its own.
+type Context struct {
+	// Table is the name of the table the row belongs to
+	Table string
+	// Row is the 1-based position of the row in the table
+	Row int
+	// Column is the column whose value is evaluated
+	Column string
+	// Value returns the value of another column of the row, evaluating it
+	// first if needed. It is nil when there is no row to reference.
+	Value func(column string) (interface{}, error)
+	// Clock returns the current time. It is nil to use the system clock.
+	Clock func() time.Time
+	// Random is a seeded source of randomness, which makes functions such
+	// as uuid() and bcrypt() deterministic. It is nil to use crypto/rand.
+	Random *rand.Rand
+	// Locale selects the data of the fake.* functions, such as de_DE. It is
+	// empty for en_US.
+	Locale string
+}
+
+// Now returns the current time from the clock of the context, or from the
+// system clock
+func (c *Context) Now() time.Time {
+	if c == nil || c.Clock == nil {
+		return time.Now()
+	}
+	return c.Clock()
+}
+
+// seeded returns the seeded source of randomness of the context, or nil
+func (c *Context) seeded() *rand.Rand {
+	if c == nil {
+		return nil
+	}
+	return c.Random
+}
+
+// Handler is the signature of typed functions. args holds one value per
+// argument, converted to the type of its parameter.
+type Handler func(ctx *Context, args []interface{}) (interface{}, error)
+
+// Function is a typed function together with its parameters, which are
+// checked before the handler is called
+type Function struct {
+	Params []Param
+	// Variadic allows the last parameter to be repeated any number of times
+	Variadic bool
+	Handler  Handler
+}
+
+// Signature describes how a function is called, such as
+// bcrypt(password string, [cost int]) or fake.pick(choices any...)
+func (f Function) Signature(name string) string {
+	params := make([]string, len(f.Params))
+	for i, p := range f.Params {
+		param := p.Name + " " + p.Type.keyword()
+		if f.Variadic && i == len(f.Params)-1 {
+			param += "..."
+		}
+		if p.Optional {
+			param = "[" + param + "]"
+		}
+		params[i] = param
+	}
+	return name + "(" + strings.Join(params, ", ") + ")"
+}
+
+// argument is an evaluated argument together with its text
+type argument struct {
+	value interface{}
+	text  string
+}
+
+// arity returns the minimum and maximum number of arguments, with a maximum
+// of -1 for variadic functions
+func (f Function) arity() (int, int) {
+	min := 0
+	for _, p := range f.Params {
+		if !p.Optional {
+			min++
+		}
+	}
+	if f.Variadic {
+		return min, -1
+	}
+	return min, len(f.Params)
+}
+
+// describeArity describes the number of arguments a function accepts
+func (f Function) describeArity() string {
+	min, max := f.arity()
+	plural := func(n int) string {
+		if n == 1 {
+			return "1 argument"
+		}
+		return fmt.Sprintf("%d arguments", n)
+	}
+	switch {
+	case max < 0:
+		return "at least " + plural(min)
+	case max == 0:
+		return "no arguments"
+	case min == max:
+		return "exactly " + plural(min)
+	case max == min+1:
+		return fmt.Sprintf("%d or %s", min, plural(max))
+	default:
+		return fmt.Sprintf("%d to %s", min, plural(max))
+	}
+}
+
+// bind checks the number of arguments of a call and converts each argument
+// to the type of its parameter
+func (f Function) bind(name string, args []argument) ([]interface{}, error) {
+	if err := f.checkCount(name, len(args)); err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		v, err := f.convert(name, i, arg)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// checkCount checks the number of arguments of a call
+func (f Function) checkCount(name string, n int) error {
+	min, max := f.arity()
+	if n < min || max >= 0 && n > max {
+		return fmt.Errorf("function %s requires %s, got %d", name, f.describeArity(), n)
+	}
+	return nil
+}
+
+// convert converts the i-th argument of a call to the type of its
+// parameter, the last one for the arguments of a variadic function
+func (f Function) convert(name string, i int, arg argument) (interface{}, error) {
+	p := f.Params[len(f.Params)-1]
+	if i < len(f.Params) {
+		p = f.Params[i]
+	}
+	v, err := convertArg(arg, p.Type)
+	if err != nil {
+		return nil, fmt.Errorf("function %s argument %d (%s): %w", name, i+1, p.Name, err)
+	}
+	return v, nil
+}
+
+// convertArg converts an argument to the Go type of t. Strings are parsed,
+// so that text piped from functions returning strings is accepted as well.
+func convertArg(arg argument, t Type) (interface{}, error) {
+	switch t {
+	case String:
+		return arg.text, nil
+	case Int:
+		switch v := arg.value.(type) {
+		case int64:
+			return v, nil
+		case int:
+			return int64(v), nil
+		case float64:
+			if v == float64(int64(v)) {
+				return int64(v), nil
+			}
+		case string:
+			if i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+				return i, nil
+			}
+		}
+	case Float:
+		switch v := arg.value.(type) {
+		case float64:
+			return v, nil
+		case int64:
+			return float64(v), nil
+		case int:
+			return float64(v), nil
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				return f, nil
+			}
+		}
+	case Bool:
+		switch v := arg.value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				return b, nil
+			}
+		}
+	case Time:
+		switch v := arg.value.(type) {
+		case time.Time:
+			return v, nil
+		case string:
+			for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02"} {
+				if ts, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+					return ts, nil
+				}
+			}
+		}
+	case Bytes:
+		switch v := arg.value.(type) {
+		case []byte:
+			return v, nil
+		case string:
+			return []byte(v), nil
+		}
+	default:
+		return arg.value, nil
+	}
+	return nil, fmt.Errorf("expected %s, got %q", t, arg.text)
+}
+
+// adapt turns a FunctionHandler into a Function that receives the text of
+// any number of arguments
+func adapt(handler FunctionHandler) Function {
+	return Function{
+		Params:   []Param{{Name: "args", Type: String, Optional: true}},
+		Variadic: true,
+		Handler: func(_ *Context, args []interface{}) (interface{}, error) {
+			texts := make([]string, len(args))
+			for i, arg := range args {
+				texts[i] = arg.(string)
+			}
+			return handler(texts)
+		},
+	}
+}
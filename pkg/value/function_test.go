@@ -0,0 +1,247 @@
+package value
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestTypedFunctions(t *testing.T) {
+	r := New()
+	r.Register("add", Function{
+		Params: []Param{{Name: "a", Type: Int}, {Name: "b", Type: Int}},
+		Handler: func(_ *Context, args []interface{}) (interface{}, error) {
+			return args[0].(int64) + args[1].(int64), nil
+		},
+	})
+	r.Register("typeof", Function{
+		Params: []Param{{Name: "value", Type: Any}},
+		Handler: func(_ *Context, args []interface{}) (interface{}, error) {
+			return reflect.TypeOf(args[0]).String(), nil
+		},
+	})
+	r.Register("year", Function{
+		Params: []Param{{Name: "time", Type: Time}},
+		Handler: func(_ *Context, args []interface{}) (interface{}, error) {
+			return int64(args[0].(time.Time).Year()), nil
+		},
+	})
+	r.Register("sum", Function{
+		Params:   []Param{{Name: "first", Type: Float}, {Name: "rest", Type: Float}},
+		Variadic: true,
+		Handler: func(_ *Context, args []interface{}) (interface{}, error) {
+			total := 0.0
+			for _, arg := range args {
+				total += arg.(float64)
+			}
+			return total, nil
+		},
+	})
+	r.Register("where", Function{
+		Handler: func(ctx *Context, _ []interface{}) (interface{}, error) {
+			return ctx, nil
+		},
+	})
+
+	tests := []struct {
+		name    string
+		input   string
+		want    interface{}
+		wantErr string
+	}{
+		{name: "Integer arguments", input: "add(1, 2)", want: int64(3)},
+		{name: "Integer from text", input: `add("1", 2)`, want: int64(3)},
+		{name: "Typed result is piped", input: "add(1, 2) | typeof()", want: "int64"},
+		{name: "Typed result is nested", input: "add(add(1, 2), 3)", want: int64(6)},
+		{name: "Time argument", input: "year(2024-05-01)", want: int64(2024)},
+		{name: "Variadic", input: "sum(1, 2.5, 3)", want: 6.5},
+		{name: "Text of typed result", input: `"x" | hash() | typeof()`, want: "string"},
+		{name: "Too few arguments", input: "add(1)", wantErr: "function add requires exactly 2 arguments, got 1"},
+		{name: "Too many arguments", input: "uuid(a, b)", wantErr: "function uuid requires 0 or 1 argument, got 2"},
+		{name: "No arguments", input: "now(1)", wantErr: "function now requires no arguments, got 1"},
+		{name: "Variadic minimum", input: "sum()", wantErr: "function sum requires at least 2 arguments, got 0"},
+		{name: "Wrong type", input: "add(1, x)", wantErr: `function add argument 2 (b): expected an integer, got "x"`},
+		{name: "Wrong piped type", input: `"x" | year()`, wantErr: `function year argument 1 (time): expected a timestamp, got "x"`},
+		{name: "Column without a row", input: "col(name)", wantErr: "col can only be used in the columns of a row"},
+		{name: "Invalid bcrypt cost", input: "bcrypt(secret, 1.5)", wantErr: `function bcrypt argument 2 (cost): expected an integer, got "1.5"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.EvalExpr(tt.input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("EvalExpr() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("EvalExpr() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("EvalExpr() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	ctx := &Context{Table: "users", Row: 2, Column: "email"}
+	got, err := r.ExpandContext(ctx, "${ where() }")
+	if err != nil || got != ctx {
+		t.Errorf("ExpandContext() = %v, %v, want the context", got, err)
+	}
+}
+
+func TestCheckBeforeCall(t *testing.T) {
+	// Mistakes anywhere in an expression are reported before any function
+	// is called
+	r := New()
+	calls := 0
+	r.Register("count", Function{
+		Params: []Param{{Name: "value", Type: Any, Optional: true}},
+		Handler: func(_ *Context, _ []interface{}) (interface{}, error) {
+			calls++
+			return "counted", nil
+		},
+	})
+
+	for input, wantErr := range map[string]string{
+		"count() | now()":             "function now requires no arguments, got 1",
+		"uuid(count(), 1)":            "function uuid requires 0 or 1 argument, got 2",
+		"count(count(), missing())":   "unsupported function: missing",
+		"bcrypt(count(), x)":          `function bcrypt argument 2 (cost): expected an integer, got "x"`,
+		"count() | bcrypt(secret, 4)": "function bcrypt requires 1 or 2 arguments, got 3",
+	} {
+		if _, err := r.EvalExpr(input); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("EvalExpr(%s) error = %v, want %q", input, err, wantErr)
+		}
+	}
+	if calls != 0 {
+		t.Errorf("count() was called %d times, want none", calls)
+	}
+
+	if _, err := r.EvalExpr("null | count()"); err != nil || calls != 1 {
+		t.Errorf("EvalExpr(null | count()) error = %v after %d calls, want one call", err, calls)
+	}
+}
+
+func TestFunctionAdapters(t *testing.T) {
+	// Functions registered with a FunctionHandler receive the text of
+	// their arguments as written
+	var received []string
+	RegisterFunction("record", func(args []string) (interface{}, error) {
+		received = args
+		return len(args), nil
+	})
+	defer UnregisterFunction("record")
+
+	if _, err := EvalExpr(`record(007, 1.50, true, "a b")`); err != nil {
+		t.Fatalf("EvalExpr() error = %v", err)
+	}
+	if want := []string{"007", "1.50", "true", "a b"}; !reflect.DeepEqual(received, want) {
+		t.Errorf("record() received %q, want %q", received, want)
+	}
+
+	// Typed functions can be called through GetFunction with text arguments
+	handler, ok := GetFunction("bcrypt")
+	if !ok {
+		t.Fatal("GetFunction(bcrypt) not found")
+	}
+	if _, err := handler([]string{"secret", "x"}); err == nil || !strings.Contains(err.Error(), "expected an integer") {
+		t.Errorf("bcrypt handler error = %v, want an integer error", err)
+	}
+	if _, ok := GetFunction("missing"); ok {
+		t.Error("GetFunction(missing) found a function")
+	}
+
+	// Signatures list the parameters with their types
+	for name, want := range map[string]string{
+		"bcrypt":    "bcrypt(password string, [cost int])",
+		"fake.pick": "fake.pick(choices any...)",
+		"record":    "record([args string...])",
+		"now":       "now()",
+	} {
+		fn, ok := Lookup(name)
+		if !ok {
+			t.Fatalf("Lookup(%s) not found", name)
+		}
+		if got := fn.Signature(name); got != want {
+			t.Errorf("Signature(%s) = %q, want %q", name, got, want)
+		}
+	}
+	if names := Names(); !slices.Contains(names, "record") || !sort.StringsAreSorted(names) {
+		t.Errorf("Names() = %v, want the sorted names including record", names)
+	}
+}
+
+func TestDeterministicFunctions(t *testing.T) {
+	newContext := func(seed int64) *Context {
+		return &Context{
+			Clock:  func() time.Time { return time.Date(2024, 5, 1, 12, 30, 0, 0, time.FixedZone("", 7200)) },
+			Random: rand.New(rand.NewSource(seed)),
+		}
+	}
+
+	got, err := EvalExprContext(newContext(1), "now()")
+	if err != nil || got != "2024-05-01T10:30:00Z" {
+		t.Errorf("now() = %v, %v, want the frozen clock", got, err)
+	}
+
+	for _, input := range []string{"uuid()", "bcrypt(secret, 4)"} {
+		first, err := EvalExprContext(newContext(1), input)
+		if err != nil {
+			t.Fatalf("%s error = %v", input, err)
+		}
+		second, _ := EvalExprContext(newContext(1), input)
+		other, _ := EvalExprContext(newContext(2), input)
+		if first != second {
+			t.Errorf("%s = %v and %v with the same seed", input, first, second)
+		}
+		if first == other {
+			t.Errorf("%s = %v with different seeds", input, first)
+		}
+	}
+
+	// A salted hash must still verify like one made by the bcrypt package
+	hash, _ := EvalExprContext(newContext(1), "bcrypt(secret, 4)")
+	if err := bcrypt.CompareHashAndPassword([]byte(hash.(string)), []byte("secret")); err != nil {
+		t.Errorf("CompareHashAndPassword(%s) error = %v", hash, err)
+	}
+	if _, err := bcryptFromReader(make([]byte, 73), 4, rand.New(rand.NewSource(1))); err != bcrypt.ErrPasswordTooLong {
+		t.Errorf("bcryptFromReader() error = %v, want ErrPasswordTooLong", err)
+	}
+}
+
+func TestBcryptVectors(t *testing.T) {
+	// Published test vectors of OpenBSD bcrypt, Openwall's crypt_blowfish
+	// and the Go bcrypt package, hashed with the salt they encode
+	tests := []struct {
+		password string
+		want     string
+	}{
+		{"", "$2a$06$DCq7YPn5Rq63x1Lad4cll.TV4S6ytwfsfvkgY8jIucDrjc8deX1s."},
+		{"U*U", "$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW"},
+		{"allmine", "$2a$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga"},
+		{"passw0rd", "$2a$10$LK9XRuhNxHHCvjX3tdkRKei1QiCDUKrJRhZv7WWZPuQGRUM92rOUa"},
+	}
+	for _, tt := range tests {
+		cost, err := bcrypt.Cost([]byte(tt.want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		salt, err := bcryptEncoding.DecodeString(tt.want[7:29])
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := bcryptFromReader([]byte(tt.password), cost, bytes.NewReader(salt))
+		if err != nil || got != tt.want {
+			t.Errorf("bcryptFromReader(%q) = %s, %v, want %s", tt.password, got, err, tt.want)
+		}
+	}
+}
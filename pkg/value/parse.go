@@ -0,0 +1,324 @@
+package value
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// expr is a node of a parsed value expression
+type expr interface {
+	isExpr()
+}
+
+// literalExpr is a literal value. text is the literal as written, without
+// quotes, which is what functions taking string arguments receive.
+type literalExpr struct {
+	value interface{}
+	text  string
+}
+
+// callExpr is a function call
+type callExpr struct {
+	name string
+	args []expr
+}
+
+// pipeExpr passes the result of each stage as the last argument of the
+// function called in the next stage
+type pipeExpr struct {
+	stages []expr
+}
+
+func (*literalExpr) isExpr() {}
+func (*callExpr) isExpr()    {}
+func (*pipeExpr) isExpr()    {}
+
+// callShape matches a pipeline stage that is meant as a function call: a
+// name directly followed by parentheses
+var callShape = regexp.MustCompile(`(?s)^[A-Za-z_][\w.]*\(.*\)$`)
+
+// numberPattern matches integer and decimal literals
+var numberPattern = regexp.MustCompile(`^[-+]?[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+// parse parses a value into a pipeline. The value is split at the pipes
+// outside of quotes and parentheses. Each stage shaped like a call is parsed
+// as one, and any other stage is a literal taken as written.
+func parse(s string) (*pipeExpr, error) {
+	pipe := &pipeExpr{}
+	for _, stage := range splitPipeline(s) {
+		stage = strings.TrimSpace(stage)
+		if !callShape.MatchString(stage) {
+			pipe.stages = append(pipe.stages, &literalExpr{value: stage, text: stage})
+			continue
+		}
+
+		p := &parser{src: stage}
+		call, err := p.parseCall()
+		if err != nil {
+			return nil, err
+		}
+		if p.skipSpace(); p.pos < len(p.src) {
+			return nil, p.errorf("unexpected %q after call to %s", p.src[p.pos:], call.name)
+		}
+		pipe.stages = append(pipe.stages, call)
+	}
+	return pipe, nil
+}
+
+// parseExpr parses a complete expression as written between ${ and } or
+// after an !expr tag. Unlike the stages of parse, the expression uses the
+// argument syntax, so quoted strings and typed literals are unquoted and
+// converted.
+func parseExpr(s string) (expr, error) {
+	p := &parser{src: s}
+	e, err := p.parseArg()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.src) {
+		return nil, p.errorf("unexpected %q after the expression", p.src[p.pos:])
+	}
+	return e, nil
+}
+
+// splitPipeline splits s at the pipes outside of quotes and parentheses
+func splitPipeline(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\'':
+			if startsToken(s, i) {
+				if end := closingQuote(s, i); end > 0 {
+					i = end
+				}
+			}
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+			}
+		case '|':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// startsToken reports whether the character at i starts a token, so that a
+// quote inside a word such as O'Brien is not taken for the start of a string
+func startsToken(s string, i int) bool {
+	return i == 0 || strings.ContainsRune(" \t(,|", rune(s[i-1]))
+}
+
+// closingQuote returns the index of the quote closing the string that starts
+// at i, or -1 when the string is not terminated
+func closingQuote(s string, i int) int {
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case s[i]:
+			return j
+		}
+	}
+	return -1
+}
+
+// parser reads a function call and its arguments
+type parser struct {
+	src string
+	pos int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid expression %q at offset %d: %s", p.src, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *parser) peek() byte {
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+// parseName reads a function name, which may contain dots
+func (p *parser) parseName() string {
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '_' || c == '.' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || p.pos > start && c >= '0' && c <= '9' {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return p.src[start:p.pos]
+}
+
+// parseCall reads name(arg, ...)
+func (p *parser) parseCall() (*callExpr, error) {
+	call := &callExpr{name: p.parseName()}
+	if call.name == "" {
+		return nil, p.errorf("expected a function name")
+	}
+	if p.peek() != '(' {
+		return nil, p.errorf("expected ( after %s", call.name)
+	}
+	p.pos++
+
+	p.skipSpace()
+	if p.peek() == ')' {
+		p.pos++
+		return call, nil
+	}
+	for {
+		arg, err := p.parseArg()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ')':
+			p.pos++
+			return call, nil
+		case 0:
+			return nil, p.errorf("missing ) to close the call to %s", call.name)
+		default:
+			return nil, p.errorf("expected , or ) in the call to %s", call.name)
+		}
+	}
+}
+
+// parseArg reads an argument, which may itself be a pipeline
+func (p *parser) parseArg() (expr, error) {
+	first, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	pipe := &pipeExpr{stages: []expr{first}}
+	for {
+		p.skipSpace()
+		if p.peek() != '|' {
+			break
+		}
+		p.pos++
+		p.skipSpace()
+		call, err := p.parseCall()
+		if err != nil {
+			return nil, err
+		}
+		pipe.stages = append(pipe.stages, call)
+	}
+	if len(pipe.stages) == 1 {
+		return first, nil
+	}
+	return pipe, nil
+}
+
+// parseTerm reads a quoted string, a nested call or a bare literal
+func (p *parser) parseTerm() (expr, error) {
+	p.skipSpace()
+	switch c := p.peek(); {
+	case c == '"' || c == '\'':
+		return p.parseString()
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		start := p.pos
+		p.parseName()
+		isCall := p.peek() == '('
+		p.pos = start
+		if isCall {
+			return p.parseCall()
+		}
+	}
+	return p.parseBare()
+}
+
+// parseString reads a quoted string, in which a backslash escapes the next
+// character
+func (p *parser) parseString() (expr, error) {
+	start := p.pos
+	quote := p.src[p.pos]
+	p.pos++
+
+	var b strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		p.pos++
+		switch {
+		case c == quote:
+			return &literalExpr{value: b.String(), text: b.String()}, nil
+		case c == '\\' && p.pos < len(p.src):
+			escaped := p.src[p.pos]
+			p.pos++
+			switch escaped {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			default:
+				b.WriteByte(escaped)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	p.pos = start
+	return nil, p.errorf("unterminated string")
+}
+
+// parseBare reads an unquoted literal up to the next comma, parenthesis or
+// pipe. Numbers, true, false and null are typed; anything else is a string.
+func (p *parser) parseBare() (expr, error) {
+	start := p.pos
+	for p.pos < len(p.src) && !strings.ContainsRune(",()|", rune(p.src[p.pos])) {
+		p.pos++
+	}
+	text := strings.TrimSpace(p.src[start:p.pos])
+	if text == "" {
+		return nil, p.errorf("expected a value")
+	}
+	if p.peek() == '(' {
+		return nil, p.errorf("unexpected ( after %q", text)
+	}
+	return &literalExpr{value: literalValue(text), text: text}, nil
+}
+
+// literalValue returns the typed value of a bare literal
+func literalValue(text string) interface{} {
+	switch text {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	if numberPattern.MatchString(text) {
+		if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return i
+		}
+		if f, err := strconv.ParseFloat(text, 64); err == nil {
+			return f
+		}
+	}
+	return text
+}
@@ -0,0 +1,209 @@
+package value
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func sha(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+func TestEvalExpressions(t *testing.T) {
+	r := New()
+	r.RegisterFunction("join", func(args []string) (interface{}, error) {
+		return strings.Join(args, "/"), nil
+	})
+	r.RegisterFunction("shout", func(args []string) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("shout function requires exactly one argument")
+		}
+		return strings.ToUpper(args[0]), nil
+	})
+
+	tests := []struct {
+		name    string
+		input   string
+		want    interface{}
+		wantErr string
+	}{
+		{name: "Nested call", input: "shout(hash(x))", want: strings.ToUpper(sha("x"))},
+		{name: "Deeply nested call", input: "join(shout(a), join(b, shout(c)))", want: "A/b/C"},
+		{name: "Comma in quotes", input: `shout("a, b")`, want: "A, B"},
+		{name: "Pipe in quotes", input: `hash("p|w")`, want: sha("p|w")},
+		{name: "Pipe in quoted literal", input: `"a|b"`, want: `"a|b"`},
+		{name: "Parentheses in quotes", input: `join("(", ")")`, want: "(/)"},
+		{name: "Escaped quote", input: `shout("say \"hi\"")`, want: `SAY "HI"`},
+		{name: "Escaped single quote", input: `shout('it\'s')`, want: "IT'S"},
+		{name: "Other quote inside string", input: `shout("it's")`, want: "IT'S"},
+		{name: "Quote inside bare word", input: "shout(O'Brien)", want: "O'BRIEN"},
+		{name: "Typed literals keep their text", input: `join(12, -1.5, true, null, "007", 007)`, want: "12/-1.5/true/null/007/007"},
+		{name: "Empty string argument", input: `join("", a)`, want: "/a"},
+		{name: "Spaces around arguments", input: "join( a b ,  c )", want: "a b/c"},
+		{name: "Pipeline as argument", input: "shout(x | hash())", want: strings.ToUpper(sha("x"))},
+		{name: "Pipe into nested call", input: "x|join(shout(a))", want: "A/x"},
+		{name: "Dotted function name", input: "join.x(a)", wantErr: "unsupported function: join.x"},
+		{name: "Unterminated string", input: `shout("abc)`, wantErr: "unterminated string"},
+		{name: "Missing argument", input: "join(a,,b)", wantErr: "expected a value"},
+		{name: "Call after bare word", input: "join(a b(c))", wantErr: `unexpected ( after "a b"`},
+		{name: "Text after call", input: "shout(a) shout(b)", wantErr: `unexpected "shout(b)" after call to shout`},
+		{name: "Missing closing parenthesis", input: "join(a, shout(b)", wantErr: "missing ) to close the call to join"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Eval(tt.input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Eval() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Eval() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Eval() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalExpr(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    interface{}
+		wantErr string
+	}{
+		{name: "Call", input: " hash(x) ", want: sha("x")},
+		{name: "Quoted string is unquoted", input: `"a|b"`, want: "a|b"},
+		{name: "Quoted string piped", input: `"a|b" | hash()`, want: sha("a|b")},
+		{name: "Integer", input: "42", want: int64(42)},
+		{name: "Boolean", input: "true", want: true},
+		{name: "Null", input: "null", want: nil},
+		{name: "Bare text", input: "Call me maybe", want: "Call me maybe"},
+		{name: "Empty", input: " ", wantErr: "expected a value"},
+		{name: "Trailing text", input: "hash(x) y", wantErr: `unexpected "y" after the expression`},
+		{name: "Comma outside call", input: "a, b", wantErr: `unexpected ", b" after the expression`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EvalExpr(tt.input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("EvalExpr() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("EvalExpr() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("EvalExpr() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    interface{}
+		wantErr string
+	}{
+		{name: "No expression", input: "Call me (maybe)", want: "Call me (maybe)"},
+		{name: "Pipe is literal", input: "A|B testing", want: "A|B testing"},
+		{name: "Single expression keeps its type", input: "${ 42 }", want: int64(42)},
+		{name: "Single call", input: "${hash(x)}", want: sha("x")},
+		{name: "Embedded expressions", input: "user-${ 7 }@${ 'example.com' }", want: "user-7@example.com"},
+		{name: "Surrounding text makes a string", input: " ${ 42 }", want: " 42"},
+		{name: "Two expressions", input: "${ 1 }${ 2 }", want: "12"},
+		{name: "Brace in quotes", input: `${ hash("}") }`, want: sha("}")},
+		{name: "Escaped", input: "cost: $${ price }", want: "cost: ${ price }"},
+		{name: "Unterminated", input: "a ${ hash(x)", wantErr: "missing } to close the expression at offset 2"},
+		{name: "Invalid expression", input: "${ hash(x }", wantErr: "missing ) to close the call to hash"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Expand(tt.input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expand() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expand() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expand() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLiteralValue(t *testing.T) {
+	tests := []struct {
+		text string
+		want interface{}
+	}{
+		{"42", int64(42)},
+		{"-7", int64(-7)},
+		{"3.25", 3.25},
+		{"1e3", 1000.0},
+		{"true", true},
+		{"false", false},
+		{"null", nil},
+		{"True", "True"},
+		{"12ab", "12ab"},
+		{"123e4567-e89b", "123e4567-e89b"},
+	}
+
+	for _, tt := range tests {
+		if got := literalValue(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("literalValue(%q) = %#v, want %#v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func FuzzEval(f *testing.F) {
+	for _, seed := range []string{
+		"hash(test)", `value|hash()`, `upper(hash("a, b"))`, `uuid('it\'s')`, "hash(",
+		`"unterminated`, "a|b|c", "f(g(h(1, 2.5, true, null)))", `hash("\`, "((()))|", "x(|)",
+		"${ hash(x) }", "a $${ b } ${ 'c}' }", "${",
+	} {
+		f.Add(seed)
+	}
+
+	// Only pure and cheap functions are called, so that fuzz inputs cannot
+	// read files or the environment, or hash with a high bcrypt cost
+	r := New()
+	pure := []string{"hash", "uuid", "now", "col", "fake.name", "fake.email", "fake.phone", "fake.int", "fake.pick"}
+	for _, name := range r.Names() {
+		if !slices.Contains(pure, name) {
+			r.Unregister(name)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		pipe, err := parse(s)
+		if err != nil {
+			return
+		}
+		if len(pipe.stages) == 0 {
+			t.Fatalf("parse(%q) returned no stages", s)
+		}
+		r.Eval(s)
+		r.Expand(s)
+	})
+}
@@ -0,0 +1,91 @@
+package value
+
+import (
+	"sort"
+	"sync"
+)
+
+// Registry holds the functions available to expressions. Each Registry is
+// independent of the others, so that functions registered for one use of
+// the package do not leak into other uses in the same process.
+type Registry struct {
+	mu        sync.RWMutex
+	functions map[string]Function
+}
+
+// builtins holds the functions of the package, which every new Registry
+// starts with
+var builtins = &Registry{functions: map[string]Function{}}
+
+// defaultRegistry is the registry used by the package-level functions
+var defaultRegistry = &Registry{functions: map[string]Function{}}
+
+// builtin registers a function of the package in the built-in and the
+// default registries
+func builtin(name string, fn Function) {
+	builtins.Register(name, fn)
+	defaultRegistry.Register(name, fn)
+}
+
+// New returns a registry holding the built-in functions
+func New() *Registry {
+	return builtins.Clone()
+}
+
+// Default returns the registry used by the package-level functions, such as
+// Register and Eval
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// Clone returns a copy of the registry. Functions registered in the copy are
+// not visible in r, and the other way round.
+func (r *Registry) Clone() *Registry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	functions := make(map[string]Function, len(r.functions))
+	for name, fn := range r.functions {
+		functions[name] = fn
+	}
+	return &Registry{functions: functions}
+}
+
+// Register registers a typed function with the given name
+func (r *Registry) Register(name string, fn Function) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.functions[name] = fn
+}
+
+// RegisterFunction registers a custom function with the given name. The
+// handler receives the text of any number of arguments.
+func (r *Registry) RegisterFunction(name string, handler FunctionHandler) {
+	r.Register(name, adapt(handler))
+}
+
+// Unregister removes a function from the registry
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.functions, name)
+}
+
+// Lookup retrieves a typed function from the registry
+func (r *Registry) Lookup(name string) (Function, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	fn, exists := r.functions[name]
+	return fn, exists
+}
+
+// Names returns the names of the registered functions in alphabetical order
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.functions))
+	for name := range r.functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,55 @@
+package value
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+
+	double := Function{
+		Params: []Param{{Name: "text", Type: String}},
+		Handler: func(_ *Context, args []interface{}) (interface{}, error) {
+			return strings.Repeat(args[0].(string), 2), nil
+		},
+	}
+
+	// A new registry has the built-in functions only
+	r := New()
+	if _, ok := r.Lookup("hash"); !ok {
+		t.Error("New() has no hash function")
+	}
+	r.Register("double", double)
+	if got, err := r.EvalExpr("double(ab)"); err != nil || got != "abab" {
+		t.Errorf("EvalExpr() = %v, %v, want abab", got, err)
+	}
+
+	// Functions registered in one registry are not visible in the others
+	if _, err := New().EvalExpr("double(ab)"); err == nil || !strings.Contains(err.Error(), "unsupported function: double") {
+		t.Errorf("New().EvalExpr() error = %v, want an unsupported function", err)
+	}
+	if _, ok := Lookup("double"); ok {
+		t.Error("double leaked into the default registry")
+	}
+
+	// A clone starts with the functions of the original and then diverges
+	clone := r.Clone()
+	clone.Register("triple", double)
+	clone.Unregister("double")
+	if names := clone.Names(); slices.Contains(names, "double") || !slices.Contains(names, "triple") {
+		t.Errorf("clone Names() = %v, want triple without double", names)
+	}
+	if names := r.Names(); !slices.Contains(names, "double") || slices.Contains(names, "triple") {
+		t.Errorf("Names() = %v, want double without triple", names)
+	}
+
+	// The package-level functions use the default registry
+	if Default().Clone() == Default() {
+		t.Error("Clone() returned the same registry")
+	}
+	if got, err := Default().Expand("${ hash(x) }"); err != nil || got != sha("x") {
+		t.Errorf("Default().Expand() = %v, %v, want the hash of x", got, err)
+	}
+}
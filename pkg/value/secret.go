@@ -0,0 +1,81 @@
+package value
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// secretMask replaces secret values in output
+const secretMask = "***"
+
+// secrets holds the values read with env() and file(), longest first so
+// that a secret containing another is masked as a whole
+var secrets []string
+var secretsMutex sync.RWMutex
+
+// addSecret records a value that must not appear in output
+func addSecret(s string) {
+	if s == "" {
+		return
+	}
+	secretsMutex.Lock()
+	defer secretsMutex.Unlock()
+	for _, known := range secrets {
+		if known == s {
+			return
+		}
+	}
+	secrets = append(secrets, s)
+	sort.SliceStable(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+}
+
+// Mask replaces every value read with env() or file() in s with ***. Use
+// it for output such as dry run values and error messages.
+func Mask(s string) string {
+	secretsMutex.RLock()
+	defer secretsMutex.RUnlock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, secretMask)
+	}
+	return s
+}
+
+// init registers the functions reading environment variables and files,
+// whose values are masked in output
+func init() {
+	// Register the env function, which reads an environment variable
+	builtin("env", Function{
+		Params: []Param{{Name: "name", Type: String}, {Name: "default", Type: String, Optional: true}},
+		Handler: func(_ *Context, args []interface{}) (interface{}, error) {
+			v, ok := os.LookupEnv(args[0].(string))
+			if !ok {
+				if len(args) < 2 {
+					return nil, fmt.Errorf("environment variable %s is not set", args[0])
+				}
+				// The default is written in the seed file, so it is
+				// not a secret
+				return args[1].(string), nil
+			}
+			addSecret(v)
+			return v, nil
+		},
+	})
+
+	// Register the file function, which reads a file such as a mounted
+	// secret, without its trailing newline
+	builtin("file", Function{
+		Params: []Param{{Name: "path", Type: String}},
+		Handler: func(_ *Context, args []interface{}) (interface{}, error) {
+			data, err := os.ReadFile(args[0].(string))
+			if err != nil {
+				return nil, err
+			}
+			v := strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r")
+			addSecret(v)
+			return v, nil
+		},
+	})
+}
@@ -0,0 +1,62 @@
+package value
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSecretFunctions(t *testing.T) {
+	t.Setenv("DBLOAD_TEST_PASSWORD", "hunter2")
+	t.Setenv("DBLOAD_TEST_EMPTY", "")
+	t.Setenv("DBLOAD_TEST_SHORT", "abc12")
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("s3cr3t-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		want    interface{}
+		wantErr string
+	}{
+		{name: "Variable", input: "env(DBLOAD_TEST_PASSWORD)", want: "hunter2"},
+		{name: "Default not used", input: "env(DBLOAD_TEST_PASSWORD, other)", want: "hunter2"},
+		{name: "Default", input: "env(DBLOAD_TEST_UNSET, fallback-value)", want: "fallback-value"},
+		{name: "Set but empty", input: "env(DBLOAD_TEST_EMPTY, fallback)", want: ""},
+		{name: "Short value", input: "env(DBLOAD_TEST_SHORT)", want: "abc12"},
+		{name: "Unset", input: "env(DBLOAD_TEST_UNSET)", wantErr: "environment variable DBLOAD_TEST_UNSET is not set"},
+		{name: "File without trailing newline", input: `file("` + path + `")`, want: "s3cr3t-token"},
+		{name: "Missing file", input: `file("` + path + `.missing")`, wantErr: "no such file or directory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EvalExpr(tt.input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("EvalExpr() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("EvalExpr() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("EvalExpr() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	// Defaults come from the seed file, so they are not masked, while
+	// short values read from the environment are
+	got := Mask(`Values: [1 hunter2 s3cr3t-token fallback-value abc12] and "hunter2!"`)
+	if want := `Values: [1 *** *** fallback-value ***] and "***!"`; got != want {
+		t.Errorf("Mask() = %q, want %q", got, want)
+	}
+	if got := Mask("nothing to hide"); got != "nothing to hide" {
+		t.Errorf("Mask() = %q, want the text unchanged", got)
+	}
+}
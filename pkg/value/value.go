@@ -4,192 +4,446 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
-	"regexp"
-	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// QuotePattern matches single or double quoted strings
-var quotePattern = regexp.MustCompile(`^(['"])(.*)(['"])$`)
-
-// FunctionHandler defines the signature for custom functions
+// FunctionHandler defines the signature for custom functions taking the
+// text of their arguments. Use Function to declare typed parameters.
 type FunctionHandler func(args []string) (interface{}, error)
 
-// functionRegistry stores registered functions
-var functionRegistry = map[string]FunctionHandler{}
-var registryMutex sync.RWMutex
-
-// RegisterFunction registers a custom function with the given name
+// RegisterFunction registers a custom function with the given name in the
+// default registry. The handler receives the text of any number of
+// arguments.
 func RegisterFunction(name string, handler FunctionHandler) {
-	registryMutex.Lock()
-	defer registryMutex.Unlock()
-	functionRegistry[name] = handler
+	defaultRegistry.RegisterFunction(name, handler)
+}
+
+// Register registers a typed function with the given name in the default
+// registry
+func Register(name string, fn Function) {
+	defaultRegistry.Register(name, fn)
 }
 
-// UnregisterFunction removes a function from the registry
+// UnregisterFunction removes a function from the default registry
 func UnregisterFunction(name string) {
-	registryMutex.Lock()
-	defer registryMutex.Unlock()
-	delete(functionRegistry, name)
+	defaultRegistry.Unregister(name)
+}
+
+// Lookup retrieves a typed function from the default registry
+func Lookup(name string) (Function, bool) {
+	return defaultRegistry.Lookup(name)
+}
+
+// Names returns the names of the functions in the default registry in
+// alphabetical order
+func Names() []string {
+	return defaultRegistry.Names()
 }
 
-// GetFunction retrieves a function from the registry
+// GetFunction retrieves a function from the default registry as a
+// FunctionHandler, which converts its text arguments to the types the
+// function declares
 func GetFunction(name string) (FunctionHandler, bool) {
-	registryMutex.RLock()
-	defer registryMutex.RUnlock()
-	handler, exists := functionRegistry[name]
-	return handler, exists
+	return defaultRegistry.GetFunction(name)
+}
+
+// GetFunction is like the package-level GetFunction, and retrieves a
+// function of r
+func (r *Registry) GetFunction(name string) (FunctionHandler, bool) {
+	fn, exists := r.Lookup(name)
+	if !exists {
+		return nil, false
+	}
+	return func(texts []string) (interface{}, error) {
+		args := make([]argument, len(texts))
+		for i, text := range texts {
+			args[i] = argument{value: text, text: text}
+		}
+		values, err := fn.bind(name, args)
+		if err != nil {
+			return nil, err
+		}
+		return fn.Handler(nil, values)
+	}, true
 }
 
 // init registers the default functions
 func init() {
 	// Register the hash function (SHA-256)
-	RegisterFunction("hash", func(args []string) (interface{}, error) {
-		if len(args) != 1 {
-			return nil, fmt.Errorf("hash function requires exactly one argument, got %d", len(args))
-		}
-		h := sha256.Sum256([]byte(args[0]))
-		return hex.EncodeToString(h[:]), nil
+	builtin("hash", Function{
+		Params: []Param{{Name: "text", Type: String}},
+		Handler: func(_ *Context, args []interface{}) (interface{}, error) {
+			h := sha256.Sum256([]byte(args[0].(string)))
+			return hex.EncodeToString(h[:]), nil
+		},
 	})
 
 	// Register the bcrypt function for password hashing
-	RegisterFunction("bcrypt", func(args []string) (interface{}, error) {
-		// Check if we have 1 or 2 arguments (password, [cost])
-		if len(args) < 1 || len(args) > 2 {
-			return nil, fmt.Errorf("bcrypt function requires 1 or 2 arguments (password, [cost]), got %d", len(args))
-		}
-
-		// Default cost is 10
-		cost := bcrypt.DefaultCost
-
-		// If cost is provided, parse it
-		if len(args) == 2 {
-			var err error
-			cost, err = strconv.Atoi(args[1])
-			if err != nil {
-				return nil, fmt.Errorf("bcrypt cost must be a number: %w", err)
+	builtin("bcrypt", Function{
+		Params: []Param{{Name: "password", Type: String}, {Name: "cost", Type: Int, Optional: true}},
+		Handler: func(ctx *Context, args []interface{}) (interface{}, error) {
+			// Default cost is 10
+			cost := bcrypt.DefaultCost
+
+			// If cost is provided, validate its range
+			if len(args) == 2 {
+				c := args[1].(int64)
+				if c < int64(bcrypt.MinCost) || c > int64(bcrypt.MaxCost) {
+					return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+				}
+				cost = int(c)
 			}
 
-			// Validate cost range
-			if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
-				return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+			// Generate the hash, with a salt from the seeded source if there is one
+			if r := ctx.seeded(); r != nil {
+				hash, err := bcryptFromReader([]byte(args[0].(string)), cost, r)
+				if err != nil {
+					return nil, fmt.Errorf("bcrypt error: %w", err)
+				}
+				return hash, nil
+			}
+			hash, err := bcrypt.GenerateFromPassword([]byte(args[0].(string)), cost)
+			if err != nil {
+				return nil, fmt.Errorf("bcrypt error: %w", err)
 			}
-		}
-
-		// Generate the hash
-		hash, err := bcrypt.GenerateFromPassword([]byte(args[0]), cost)
-		if err != nil {
-			return nil, fmt.Errorf("bcrypt error: %w", err)
-		}
 
-		return string(hash), nil
+			return string(hash), nil
+		},
 	})
 
 	// Register the now function
-	RegisterFunction("now", func(args []string) (interface{}, error) {
-		if len(args) != 0 {
-			return nil, fmt.Errorf("now function requires no arguments, got %d", len(args))
-		}
-		return time.Now().UTC().Format(time.RFC3339), nil
+	builtin("now", Function{
+		Handler: func(ctx *Context, _ []interface{}) (interface{}, error) {
+			return ctx.Now().UTC().Format(time.RFC3339), nil
+		},
 	})
 
-	// Register the uuid function with optional seed support
-	RegisterFunction("uuid", func(args []string) (interface{}, error) {
-		// Check if we have 0 or 1 arguments (optional seed)
-		if len(args) > 1 {
-			return nil, fmt.Errorf("uuid function requires 0 or 1 arguments (optional seed), got %d", len(args))
-		}
+	// Register the col function, which returns another column of the row
+	builtin("col", Function{
+		Params: []Param{{Name: "column", Type: String}},
+		Handler: func(ctx *Context, args []interface{}) (interface{}, error) {
+			if ctx == nil || ctx.Value == nil {
+				return nil, fmt.Errorf("col can only be used in the columns of a row")
+			}
+			return ctx.Value(args[0].(string))
+		},
+	})
 
-		// If no seed is provided, generate a random UUID
-		if len(args) == 0 {
-			return uuid.New().String(), nil
-		}
+	// Register the uuid function with optional seed support
+	builtin("uuid", Function{
+		Params: []Param{{Name: "seed", Type: String, Optional: true}},
+		Handler: func(ctx *Context, args []interface{}) (interface{}, error) {
+			// If no seed is provided, generate a random UUID
+			if len(args) == 0 {
+				if r := ctx.seeded(); r != nil {
+					id, err := uuid.NewRandomFromReader(r)
+					if err != nil {
+						return nil, err
+					}
+					return id.String(), nil
+				}
+				return uuid.New().String(), nil
+			}
 
-		// If a seed is provided, generate a deterministic UUID based on the seed
-		// This allows referencing the same UUID across different tables
-		seed := args[0]
+			// If a seed is provided, generate a deterministic UUID based on the seed
+			// This allows referencing the same UUID across different tables
+			seed := args[0].(string)
 
-		// Create a UUID v5 with the DNS namespace and the seed
-		// This will generate a consistent UUID for the same seed
-		deterministicUUID := uuid.NewSHA1(uuid.NameSpaceDNS, []byte(seed))
+			// Create a UUID v5 with the DNS namespace and the seed
+			// This will generate a consistent UUID for the same seed
+			deterministicUUID := uuid.NewSHA1(uuid.NameSpaceDNS, []byte(seed))
 
-		return deterministicUUID.String(), nil
+			return deterministicUUID.String(), nil
+		},
 	})
 }
 
-// FunctionCallPattern matches function calls with parentheses: function(arg1, arg2, ...)
-var functionCallPattern = regexp.MustCompile(`^(\w+)\((.*)\)$`)
-
 // Eval evaluates a string value according to the specified rules:
 // 1. String can be separated as multiple parts using pipe '|'
 // 2. Each part can be a literal value or a function call
 // 3. Function calls must use the syntax: function(arg1, arg2, ...)
 // 4. If there is a part before a function call, the previous part's value will be the last argument of the next function call
+//
+// Arguments may be nested calls, pipelines, quoted strings in which commas,
+// pipes and parentheses are taken literally and a backslash escapes the next
+// character, or bare literals such as numbers, true, false and null. Pipes
+// and parentheses inside quotes do not split the value.
 func Eval(value string) (interface{}, error) {
-	parts := strings.Split(value, "|")
-	var result interface{}
+	return defaultRegistry.EvalContext(nil, value)
+}
 
-	for i, part := range parts {
-		part = strings.TrimSpace(part)
+// EvalContext is like Eval, and passes ctx to the functions it calls
+func EvalContext(ctx *Context, value string) (interface{}, error) {
+	return defaultRegistry.EvalContext(ctx, value)
+}
 
-		// Check if this is a function call
-		matches := functionCallPattern.FindStringSubmatch(part)
-		if matches == nil || len(matches) != 3 {
-			// It's a literal value
-			result = part
-			continue
-		}
+// Eval is like the package-level Eval, and calls the functions of r
+func (r *Registry) Eval(value string) (interface{}, error) {
+	return r.EvalContext(nil, value)
+}
 
-		// It's a function call
-		fn := matches[1]
-		argsStr := matches[2]
-
-		// Parse arguments - split by comma, but respect quotes
-		var args []string
-		if argsStr != "" {
-			// Simple argument parsing - split by comma and trim spaces
-			args = strings.Split(argsStr, ",")
-			for i, arg := range args {
-				args[i] = strings.TrimSpace(arg)
-
-				// Remove quotes if present
-				if len(args[i]) > 1 {
-					if (args[i][0] == '"' && args[i][len(args[i])-1] == '"') ||
-						(args[i][0] == '\'' && args[i][len(args[i])-1] == '\'') {
-						args[i] = args[i][1 : len(args[i])-1]
-					}
+// EvalContext is like Eval, and passes ctx to the functions it calls
+func (r *Registry) EvalContext(ctx *Context, value string) (interface{}, error) {
+	pipe, err := parse(value)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.check(pipe); err != nil {
+		return nil, err
+	}
+	result, _, err := r.eval(ctx, pipe)
+	return result, err
+}
+
+// check validates an expression before any of its functions is called:
+// every function must exist and accept the number of arguments given and
+// the literal ones among them. A mistake is thereby reported without
+// running the functions evaluated before it.
+func (r *Registry) check(e expr) error {
+	switch e := e.(type) {
+	case *callExpr:
+		return r.checkCall(e, nil)
+	case *pipeExpr:
+		for i, stage := range e.stages {
+			c, ok := stage.(*callExpr)
+			if !ok {
+				if err := r.check(stage); err != nil {
+					return err
+				}
+				continue
+			}
+			// The previous stage is piped in, unless it is a literal null
+			var piped []expr
+			if i > 0 {
+				if lit, ok := e.stages[i-1].(*literalExpr); !ok || lit.value != nil {
+					piped = e.stages[i-1 : i]
 				}
 			}
+			if err := r.checkCall(c, piped); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkCall validates a call and its arguments, followed by the piped stage
+func (r *Registry) checkCall(c *callExpr, piped []expr) error {
+	fn, exists := r.Lookup(c.name)
+	if !exists {
+		return fmt.Errorf("unsupported function: %s", c.name)
+	}
+	for _, arg := range c.args {
+		if err := r.check(arg); err != nil {
+			return err
+		}
+	}
+
+	args := append(c.args[:len(c.args):len(c.args)], piped...)
+	if err := fn.checkCount(c.name, len(args)); err != nil {
+		return err
+	}
+	for i, arg := range args {
+		if lit, ok := arg.(*literalExpr); ok {
+			if _, err := fn.convert(c.name, i, argument{value: lit.value, text: lit.text}); err != nil {
+				return err
+			}
 		}
+	}
+	return nil
+}
 
-		// If there was a previous result and this isn't the first part,
-		// add it as an argument
-		if i > 0 && result != nil {
-			resultStr, ok := result.(string)
+// eval evaluates an expression and returns its value together with its
+// text, which is passed to functions taking string arguments
+func (r *Registry) eval(ctx *Context, e expr) (interface{}, string, error) {
+	switch e := e.(type) {
+	case *literalExpr:
+		return e.value, e.text, nil
+	case *callExpr:
+		return r.call(ctx, e, nil)
+	case *pipeExpr:
+		var result interface{}
+		var text string
+		for i, stage := range e.stages {
+			c, ok := stage.(*callExpr)
 			if !ok {
-				resultStr = fmt.Sprintf("%v", result)
+				var err error
+				if result, text, err = r.eval(ctx, stage); err != nil {
+					return nil, "", err
+				}
+				continue
+			}
+
+			// If there was a previous result and this isn't the first part,
+			// add it as an argument
+			var piped []argument
+			if i > 0 && result != nil {
+				piped = []argument{{value: result, text: text}}
+			}
+			var err error
+			if result, text, err = r.call(ctx, c, piped); err != nil {
+				return nil, "", err
 			}
-			args = append(args, resultStr)
 		}
+		return result, text, nil
+	default:
+		return nil, "", fmt.Errorf("unknown expression %T", e)
+	}
+}
+
+// call evaluates the arguments of a call, appends the piped values, checks
+// the arguments against the parameters of the function and calls it
+func (r *Registry) call(ctx *Context, c *callExpr, piped []argument) (interface{}, string, error) {
+	// Look up the function in the registry
+	fn, exists := r.Lookup(c.name)
+	if !exists {
+		return nil, "", fmt.Errorf("unsupported function: %s", c.name)
+	}
+
+	args := make([]argument, 0, len(c.args)+len(piped))
+	for _, arg := range c.args {
+		v, text, err := r.eval(ctx, arg)
+		if err != nil {
+			return nil, "", err
+		}
+		args = append(args, argument{value: v, text: text})
+	}
+	args = append(args, piped...)
+
+	values, err := fn.bind(c.name, args)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Call the function handler
+	result, err := fn.Handler(ctx, values)
+	if err != nil {
+		return nil, "", fmt.Errorf("function %s error: %w", c.name, err)
+	}
+	return result, resultText(result), nil
+}
+
+// resultText converts the result of a function to the text passed on to
+// other functions
+func resultText(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// EvalExpr evaluates a single expression, such as `upper(hash("a|b"))` or
+// `"text" | hash()`. Quoted strings are unquoted and bare numbers, true,
+// false and null evaluate to typed values.
+func EvalExpr(src string) (interface{}, error) {
+	return defaultRegistry.EvalExprContext(nil, src)
+}
+
+// EvalExprContext is like EvalExpr, and passes ctx to the functions it calls
+func EvalExprContext(ctx *Context, src string) (interface{}, error) {
+	return defaultRegistry.EvalExprContext(ctx, src)
+}
+
+// EvalExpr is like the package-level EvalExpr, and calls the functions of r
+func (r *Registry) EvalExpr(src string) (interface{}, error) {
+	return r.EvalExprContext(nil, src)
+}
+
+// EvalExprContext is like EvalExpr, and passes ctx to the functions it calls
+func (r *Registry) EvalExprContext(ctx *Context, src string) (interface{}, error) {
+	e, err := parseExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.check(e); err != nil {
+		return nil, err
+	}
+	result, _, err := r.eval(ctx, e)
+	return result, err
+}
+
+// Expand evaluates the ${ expr } blocks embedded in s. When s consists of a
+// single block, the value of the expression is returned as it is; otherwise
+// the text of each result replaces its block. $${ stands for a literal ${.
+func Expand(s string) (interface{}, error) {
+	return defaultRegistry.ExpandContext(nil, s)
+}
 
-		// Look up the function in the registry
-		handler, exists := GetFunction(fn)
-		if !exists {
-			return nil, fmt.Errorf("unsupported function: %s", fn)
+// ExpandContext is like Expand, and passes ctx to the functions it calls
+func ExpandContext(ctx *Context, s string) (interface{}, error) {
+	return defaultRegistry.ExpandContext(ctx, s)
+}
+
+// Expand is like the package-level Expand, and calls the functions of r
+func (r *Registry) Expand(s string) (interface{}, error) {
+	return r.ExpandContext(nil, s)
+}
+
+// ExpandContext is like Expand, and passes ctx to the functions it calls
+func (r *Registry) ExpandContext(ctx *Context, s string) (interface{}, error) {
+	var b strings.Builder
+	var single interface{}
+	blocks := 0
+	rest := s
+	for {
+		i := strings.Index(rest, "${")
+		if i < 0 {
+			b.WriteString(rest)
+			break
 		}
+		if i > 0 && rest[i-1] == '$' {
+			b.WriteString(rest[:i-1] + "${")
+			rest = rest[i+2:]
+			continue
+		}
+		b.WriteString(rest[:i])
 
-		// Call the function handler
-		var err error
-		result, err = handler(args)
+		end := closingBrace(rest, i+2)
+		if end < 0 {
+			return nil, fmt.Errorf("missing } to close the expression at offset %d in %q", len(s)-len(rest)+i, s)
+		}
+		result, err := r.EvalExprContext(ctx, rest[i+2:end])
 		if err != nil {
-			return nil, fmt.Errorf("function %s error: %w", fn, err)
+			return nil, err
 		}
+		single = result
+		blocks++
+		b.WriteString(resultText(result))
+		rest = rest[end+1:]
 	}
 
-	return result, nil
+	if blocks == 1 && strings.HasPrefix(s, "${") && closingBrace(s, 2) == len(s)-1 {
+		return single, nil
+	}
+	return b.String(), nil
+}
+
+// closingBrace returns the index of the } that closes an expression starting
+// at i, skipping quoted strings, or -1 when there is none
+func closingBrace(s string, i int) int {
+	for ; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\'':
+			if startsToken(s, i) {
+				if end := closingQuote(s, i); end > 0 {
+					i = end
+				}
+			}
+		case '}':
+			return i
+		}
+	}
+	return -1
 }